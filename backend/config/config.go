@@ -16,10 +16,39 @@ type Config struct {
 	JWTSecret   string
 	FrontendURL string
 	UploadDir   string
+
+	AccessTokenTTLMinutes int
+	RefreshTokenTTLHours  int
+
+	MailDriver   string
+	MailFrom     string
+	MailLogFile  string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	MaxUploadMB   int
+	MaxVideoMB    int
+	MaxRequestMB  int
+	StorageDriver string
+	S3Endpoint    string
+	S3Region      string
+	S3Bucket      string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3PublicURL   string
+
+	RankingIntervalMinutes     int
+	SearchWordsIntervalMinutes int
 }
 
 var AppConfig Config
 
+// DefaultJWTSecret is the placeholder used when JWT_SECRET is unset. It is
+// public, so the server refuses to start with it.
+const DefaultJWTSecret = "your_jwt_secret_key_here"
+
 func LoadConfig() {
 	// Database Configuration
 	AppConfig.DBHost = getEnv("DB_HOST", "localhost")
@@ -31,8 +60,37 @@ func LoadConfig() {
 	// Server Configuration
 	AppConfig.Port = getEnv("PORT", "8080")
 	AppConfig.FrontendURL = getEnv("FRONTEND_URL", "http://localhost:5173")
-	AppConfig.JWTSecret = getEnv("JWT_SECRET", "your_jwt_secret_key_here")
+	AppConfig.JWTSecret = getEnv("JWT_SECRET", DefaultJWTSecret)
 	AppConfig.UploadDir = getEnv("UPLOAD_DIR", "./uploads")
+
+	// Session Configuration
+	AppConfig.AccessTokenTTLMinutes = getEnvAsInt("ACCESS_TOKEN_TTL_MINUTES", 15)
+	AppConfig.RefreshTokenTTLHours = getEnvAsInt("REFRESH_TOKEN_TTL_HOURS", 720)
+
+	// Mail Configuration ("smtp" or "log")
+	AppConfig.MailDriver = getEnv("MAIL_DRIVER", "log")
+	AppConfig.MailFrom = getEnv("MAIL_FROM", "no-reply@lifeskill.local")
+	AppConfig.MailLogFile = getEnv("MAIL_LOG_FILE", "")
+	AppConfig.SMTPHost = getEnv("SMTP_HOST", "localhost")
+	AppConfig.SMTPPort = getEnvAsInt("SMTP_PORT", 587)
+	AppConfig.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	AppConfig.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+
+	// Media Storage Configuration ("local" or "s3")
+	AppConfig.MaxUploadMB = getEnvAsInt("MAX_UPLOAD_MB", 5)
+	AppConfig.MaxVideoMB = getEnvAsInt("MAX_VIDEO_MB", 25)
+	AppConfig.MaxRequestMB = getEnvAsInt("MAX_REQUEST_MB", 60)
+	AppConfig.StorageDriver = getEnv("STORAGE_DRIVER", "local")
+	AppConfig.S3Endpoint = getEnv("S3_ENDPOINT", "http://localhost:9000")
+	AppConfig.S3Region = getEnv("S3_REGION", "us-east-1")
+	AppConfig.S3Bucket = getEnv("S3_BUCKET", "lifeskill")
+	AppConfig.S3AccessKey = getEnv("S3_ACCESS_KEY", "")
+	AppConfig.S3SecretKey = getEnv("S3_SECRET_KEY", "")
+	AppConfig.S3PublicURL = getEnv("S3_PUBLIC_URL", "")
+
+	// Ranking Configuration
+	AppConfig.RankingIntervalMinutes = getEnvAsPositiveInt("RANKING_INTERVAL_MINUTES", 10)
+	AppConfig.SearchWordsIntervalMinutes = getEnvAsPositiveInt("SEARCH_WORDS_INTERVAL_MINUTES", 60)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -51,6 +109,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsPositiveInt is getEnvAsInt for values that must be above zero,
+// such as intervals; zero or negative values fall back to the default
+func getEnvAsPositiveInt(key string, defaultValue int) int {
+	if value := getEnvAsInt(key, defaultValue); value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
 func GetDSN() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		AppConfig.DBHost,
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dadadun/lifskill/config"
+	"github.com/dadadun/lifskill/mail"
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Account token purposes
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenPasswordReset = "password_reset"
+)
+
+var tokenTTL = map[string]time.Duration{
+	TokenVerifyEmail:   48 * time.Hour,
+	TokenPasswordReset: time.Hour,
+}
+
+// AccountToken records an emailed token so it can be used only once. The
+// token itself is a signed JWT whose Id is this record's ID.
+type AccountToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index"`
+	Purpose   string     `gorm:"size:30;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	User      User       `gorm:"foreignKey:UserID;references:ID"`
+}
+
+var errInvalidAccountToken = errors.New("invalid or expired token")
+
+// accountTokenKey signs emailed tokens. It is derived from the JWT secret
+// so no extra secret has to be configured, but differs from it, so an
+// emailed token can never pass as an access token. Like JWTKey it fails
+// while the secret is unset, rather than deriving a key anyone can compute.
+func accountTokenKey() ([]byte, error) {
+	secret, err := JWTKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("account-tokens"))
+	return mac.Sum(nil), nil
+}
+
+// issueAccountToken invalidates the user's earlier unused tokens for the
+// purpose and signs a new one
+func issueAccountToken(db *gorm.DB, userID uint, purpose string) (string, error) {
+	key, err := accountTokenKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := db.Model(&AccountToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	record := AccountToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(tokenTTL[purpose]),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	claims := jwt.StandardClaims{
+		Id:        strconv.FormatUint(uint64(record.ID), 10),
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Audience:  purpose,
+		ExpiresAt: record.ExpiresAt.Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// consumeAccountToken checks a token's signature, purpose and expiry and
+// marks it used, returning the user it was issued for
+func consumeAccountToken(db *gorm.DB, token, purpose string) (uint, error) {
+	claims := &jwt.StandardClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errInvalidAccountToken
+		}
+		return accountTokenKey()
+	})
+	if err != nil || !parsed.Valid || !claims.VerifyAudience(purpose, true) {
+		return 0, errInvalidAccountToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, errInvalidAccountToken
+	}
+
+	// Single use: only the first request can flip used_at
+	result := db.Model(&AccountToken{}).
+		Where("id = ? AND user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+			claims.Id, userID, purpose, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil || result.RowsAffected != 1 {
+		return 0, errInvalidAccountToken
+	}
+	return uint(userID), nil
+}
+
+// sendVerificationEmail emails the user a link to verify their address
+func sendVerificationEmail(db *gorm.DB, mailer mail.Sender, user User) error {
+	token, err := issueAccountToken(db, user.ID, TokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening this link:\n%s/verify-email?token=%s\n\nThe link expires in 48 hours.\n",
+			user.Username, config.AppConfig.FrontendURL, token),
+	})
+}
+
+// Resend the verification email to the current user
+func RequestEmailVerification(db *gorm.DB, mailer mail.Sender) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var user User
+		if err := db.First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		if user.EmailVerified {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email is already verified"})
+		}
+
+		if err := sendVerificationEmail(db, mailer, user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send verification email"})
+		}
+		return c.JSON(fiber.Map{"message": "Verification email sent"})
+	}
+}
+
+// Verify an email address with a token from a verification email
+func VerifyEmail(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input struct {
+			Token string `json:"token"`
+		}
+		if err := c.BodyParser(&input); err != nil || input.Token == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token is required"})
+		}
+
+		userID, err := consumeAccountToken(db, input.Token, TokenVerifyEmail)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": time.Now(),
+		}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify email"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Email verified"})
+	}
+}
+
+// Email a password reset link. Always answers the same way so it cannot
+// be used to find out which emails have accounts.
+func RequestPasswordReset(db *gorm.DB, mailer mail.Sender) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input struct {
+			Email string `json:"email"`
+		}
+		if err := c.BodyParser(&input); err != nil || input.Email == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email is required"})
+		}
+
+		var user User
+		if err := db.Where("email = ?", input.Email).First(&user).Error; err == nil && !user.Suspended {
+			token, err := issueAccountToken(db, user.ID, TokenPasswordReset)
+			if err == nil {
+				err = mailer.Send(mail.Message{
+					To:      user.Email,
+					Subject: "Reset your password",
+					Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. If it was you, open this link:\n%s/reset-password?token=%s\n\nThe link expires in 1 hour. If you did not ask for this, you can ignore this email.\n",
+						user.Username, config.AppConfig.FrontendURL, token),
+				})
+			}
+			if err != nil {
+				log.Printf("password reset for user %d: %v", user.ID, err)
+			}
+		}
+
+		return c.JSON(fiber.Map{"message": "If the email belongs to an account, a reset link has been sent"})
+	}
+}
+
+// Set a new password with a token from a password reset email
+func ResetPassword(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input struct {
+			Token       string `json:"token" validate:"required"`
+			NewPassword string `json:"newPassword" validate:"required,min=6,maxbytes=72"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if errs := validation.Struct(&input); errs != nil {
+			return validation.Reply(c, errs)
+		}
+
+		userID, err := consumeAccountToken(db, input.Token, TokenPasswordReset)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash new password"})
+		}
+
+		// Reaching the reset link also proves the email address
+		if err := db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":          string(hashedPassword),
+			"email_verified":    true,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
+		}
+
+		// Log out every device that used the old password
+		if err := RevokeUserSessions(db, userID, 0); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Password updated but failed to revoke sessions"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Password has been reset"})
+	}
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Achievement event sources
+const (
+	SourcePostCompleted  = "post_completed"
+	SourceBookmarked     = "bookmarked"
+	SourceUnbookmarked   = "unbookmarked"
+	SourceCategoryMerged = "category_merged"
+	SourceLegacy         = "legacy" // scores carried over from total_achievements
+)
+
+// reversibleSources earn points that can be taken back later, so they
+// don't count towards levels and badges
+var reversibleSources = []string{SourceBookmarked, SourceUnbookmarked}
+
+// AchievementEvent is one entry of the append-only achievement ledger.
+// Rows are never updated or deleted: a user's score in a category is the
+// sum of their events' points, and corrections are new events.
+type AchievementEvent struct {
+	ID         uint      `gorm:"primaryKey"`
+	UserID     uint      `gorm:"not null;index:idx_achievement_events_user_category"`
+	CategoryID uint      `gorm:"not null;index:idx_achievement_events_user_category;index:idx_achievement_events_category_created"`
+	PostID     *uint     `gorm:"index"`
+	Source     string    `gorm:"size:30;not null"`
+	Points     int       `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null;index;index:idx_achievement_events_category_created"`
+}
+
+// CategoryScore is a user's score in one category
+type CategoryScore struct {
+	CategoryID   uint   `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	Score        int    `json:"score"`
+}
+
+// recordAchievement appends one event per category and awards any badges
+// the new score reaches. Reversible sources never award badges.
+func recordAchievement(tx *gorm.DB, userID uint, categories []Category, postID *uint, source string, points int) error {
+	if len(categories) == 0 {
+		return nil
+	}
+	now := time.Now()
+	events := make([]AchievementEvent, 0, len(categories))
+	for _, cat := range categories {
+		events = append(events, AchievementEvent{
+			UserID:     userID,
+			CategoryID: cat.ID,
+			PostID:     postID,
+			Source:     source,
+			Points:     points,
+			CreatedAt:  now,
+		})
+	}
+	if err := tx.Create(&events).Error; err != nil {
+		return err
+	}
+	if points > 0 && source != SourceBookmarked {
+		return refreshBadges(tx, userID)
+	}
+	return nil
+}
+
+// categoryScores sums a user's ledger per category, leaving out deleted
+// categories
+func categoryScores(db *gorm.DB, userID uint) ([]CategoryScore, error) {
+	return sumCategoryScores(db, userID, nil)
+}
+
+// levelScores is categoryScores without reversible sources, the score
+// levels and badges are measured against
+func levelScores(db *gorm.DB, userID uint) ([]CategoryScore, error) {
+	return sumCategoryScores(db, userID, reversibleSources)
+}
+
+func sumCategoryScores(db *gorm.DB, userID uint, excludedSources []string) ([]CategoryScore, error) {
+	scores := []CategoryScore{}
+	query := db.Table("achievement_events e").
+		Select("e.category_id, c.categories_name AS category_name, SUM(e.points) AS score").
+		Joins("JOIN categories c ON c.id = e.category_id AND c.deleted_at IS NULL").
+		Where("e.user_id = ?", userID)
+	if len(excludedSources) > 0 {
+		query = query.Where("e.source NOT IN ?", excludedSources)
+	}
+	err := query.Group("e.category_id, c.categories_name").
+		Having("SUM(e.points) <> 0").
+		Order("score DESC, e.category_id").
+		Scan(&scores).Error
+	return scores, err
+}
+
+// moveAchievements transfers every user's score from one category to
+// another by appending balancing events to both
+func moveAchievements(tx *gorm.DB, fromID, toID uint) error {
+	now := time.Now()
+	return tx.Exec(`INSERT INTO achievement_events (user_id, category_id, source, points, created_at)
+		SELECT user_id, cat.id, ?, CASE WHEN cat.id = ? THEN -SUM(points) ELSE SUM(points) END, ?
+		FROM achievement_events
+		CROSS JOIN (VALUES (?::bigint), (?::bigint)) AS cat(id)
+		WHERE category_id = ?
+		GROUP BY user_id, cat.id
+		HAVING SUM(points) <> 0`,
+		SourceCategoryMerged, fromID, now, fromID, toID, fromID).Error
+}
+
+// backfillAchievementEvents seeds an empty ledger from the scores kept in
+// the old total_achievements table, whose category column was named
+// "Categories_id"
+func backfillAchievementEvents(db *gorm.DB) {
+	if !db.Migrator().HasTable("total_achievements") {
+		return
+	}
+	var count int64
+	if err := db.Model(&AchievementEvent{}).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	if err := db.Exec(`INSERT INTO achievement_events (user_id, category_id, source, points, created_at)
+		SELECT user_id, "Categories_id", ?, score, ? FROM total_achievements WHERE score <> 0`,
+		SourceLegacy, time.Now()).Error; err != nil {
+		log.Printf("Failed to backfill achievement events: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dadadun/lifskill/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AdminUserDTO is the user view returned by the admin console
+type AdminUserDTO struct {
+	ID        uint               `json:"id"`
+	Username  string             `json:"username"`
+	Email     string             `json:"email"`
+	Role      string             `json:"role"`
+	Suspended bool               `json:"suspended"`
+	Picture   *storage.ImageURLs `json:"picture"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+func toAdminUserDTO(user User) AdminUserDTO {
+	return AdminUserDTO{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		Suspended: user.Suspended,
+		Picture:   storage.ImageURLsFor(user.Picture),
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// List and search users by username or email (admin only)
+func AdminListUsers(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query := c.Query("q", "")
+		role := c.Query("role", "")
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		tx := db.Model(&User{})
+		if query != "" {
+			tx = tx.Where("username ILIKE ? OR email ILIKE ?", "%"+query+"%", "%"+query+"%")
+		}
+		if role != "" {
+			tx = tx.Where("role = ?", role)
+		}
+
+		var total int64
+		tx.Count(&total)
+
+		var users []User
+		if err := tx.Order("created_at desc").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch users"})
+		}
+
+		userDTOs := []AdminUserDTO{}
+		for _, user := range users {
+			userDTOs = append(userDTOs, toAdminUserDTO(user))
+		}
+
+		return c.JSON(fiber.Map{
+			"users": userDTOs,
+			"total": total,
+		})
+	}
+}
+
+// Delete a user account together with their posts, comments, bookmarks
+// and follows, and sign it out everywhere (admin only). Likes, approvals,
+// reviews and the achievement ledger are kept: they are counted into
+// other users' posts and scores, and the ledger is append-only.
+func AdminDeleteUser(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actorID := c.Locals("userID").(uint)
+
+		var user User
+		if err := db.First(&user, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		if user.ID == actorID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot delete your own account here"})
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", user.ID).Delete(&Comment{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&Post{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&UserExpertCategory{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("follower_id = ? OR followee_id = ?", user.ID, user.ID).Delete(&Follow{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&Bookmark{}).Error; err != nil {
+				return err
+			}
+			if err := RevokeUserSessions(tx, user.ID, 0); err != nil {
+				return err
+			}
+			return tx.Delete(&user).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user"})
+		}
+
+		return c.JSON(fiber.Map{"message": "User deleted"})
+	}
+}
+
+// Force a post's status regardless of the expert approval rule (admin only)
+func AdminSetPostStatus(db *gorm.DB, status string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var post Post
+		if err := db.First(&post, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+
+		post.Status = status
+		if err := db.Save(&post).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update post status"})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Post status updated",
+			"status":  post.Status,
+		})
+	}
+}
+
+// Rename a category (admin only)
+func AdminRenameCategory(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input struct {
+			CategoriesName string `json:"categories_name"`
+		}
+		if err := c.BodyParser(&input); err != nil || input.CategoriesName == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "categories_name is required"})
+		}
+
+		var category Category
+		if err := db.First(&category, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+
+		if err := db.Model(&category).Update("categories_name", input.CategoriesName).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rename category"})
+		}
+		category.CategoriesName = input.CategoriesName
+
+		return c.JSON(CategoryDTO{ID: category.ID, CategoriesName: category.CategoriesName})
+	}
+}
+
+// Merge one category into another, moving posts, requests, experts and achievement
+// scores over to the target before deleting the source (admin only)
+func AdminMergeCategory(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input struct {
+			IntoID uint `json:"into_id"`
+		}
+		if err := c.BodyParser(&input); err != nil || input.IntoID == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "into_id is required"})
+		}
+
+		var source, target Category
+		if err := db.First(&source, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+		if err := db.First(&target, input.IntoID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Target category not found"})
+		}
+		if source.ID == target.ID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot merge a category into itself"})
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`INSERT INTO post_categories (post_id, category_id)
+				SELECT post_id, ? FROM post_categories WHERE category_id = ?
+				ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(`INSERT INTO request_post_categories (request_post_id, category_id)
+				SELECT request_post_id, ? FROM request_post_categories WHERE category_id = ?
+				ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(`INSERT INTO user_expert_categories (user_id, category_id)
+				SELECT user_id, ? FROM user_expert_categories WHERE category_id = ?
+				ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+				return err
+			}
+			if err := moveAchievements(tx, source.ID, target.ID); err != nil {
+				return err
+			}
+			return deleteCategory(tx, source.ID)
+		})
+		if err != nil {
+			log.Printf("Failed to merge category %d into %d: %v", source.ID, target.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to merge categories"})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Categories merged",
+			"into":    CategoryDTO{ID: target.ID, CategoriesName: target.CategoriesName},
+		})
+	}
+}
+
+// Delete a category and detach it from posts, experts and achievements (admin only)
+func AdminDeleteCategory(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var category Category
+		if err := db.First(&category, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return deleteCategory(tx, category.ID)
+		}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Category deleted"})
+	}
+}
+
+// deleteCategory removes every row that references the category, then the category itself
+func deleteCategory(tx *gorm.DB, categoryID uint) error {
+	if err := tx.Exec("DELETE FROM post_categories WHERE category_id = ?", categoryID).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM request_post_categories WHERE category_id = ?", categoryID).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM user_expert_categories WHERE category_id = ?", categoryID).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&Category{}, categoryID).Error
+}
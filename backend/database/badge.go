@@ -0,0 +1,326 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CategoryLevel is a named level reached at MinScore points in a
+// category, e.g. "Master Cook" at 50 points in Cooking
+type CategoryLevel struct {
+	ID         uint   `gorm:"primaryKey"`
+	CategoryID uint   `gorm:"not null;index"`
+	Name       string `gorm:"size:50;not null"`
+	MinScore   int    `gorm:"not null"`
+}
+
+// defaultLevels apply to categories without levels of their own
+var defaultLevels = []CategoryLevel{
+	{Name: "Novice", MinScore: 1},
+	{Name: "Apprentice", MinScore: 10},
+	{Name: "Skilled", MinScore: 25},
+	{Name: "Master", MinScore: 50},
+}
+
+// Milestone is a badge earned across categories
+type Milestone struct {
+	Code        string
+	Name        string
+	Description string
+	Categories  int // number of categories that need MinScore
+	MinScore    int
+}
+
+var milestones = []Milestone{
+	{Code: "explorer", Name: "Explorer", Description: "Earned points in 3 categories", Categories: 3, MinScore: 1},
+	{Code: "all_rounder", Name: "All-Rounder", Description: "Reached 10 points in 3 categories", Categories: 3, MinScore: 10},
+	{Code: "polymath", Name: "Polymath", Description: "Reached 25 points in 5 categories", Categories: 5, MinScore: 25},
+}
+
+// UserBadge is a badge a user was awarded. Badges are kept even if the
+// score behind them drops later.
+type UserBadge struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_user_badges_user_code"`
+	Code        string    `gorm:"size:80;not null;uniqueIndex:idx_user_badges_user_code"`
+	Name        string    `gorm:"size:100;not null"`
+	Description string    `gorm:"size:255"`
+	CategoryID  *uint     `gorm:"index"`
+	AwardedAt   time.Time `gorm:"not null"`
+}
+
+type BadgeDTO struct {
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CategoryID  *uint     `json:"category_id"`
+	AwardedAt   time.Time `json:"awarded_at"`
+}
+
+type LevelDTO struct {
+	Name     string `json:"name"`
+	MinScore int    `json:"min_score"`
+}
+
+// LevelProgressDTO is where a user stands in a category
+type LevelProgressDTO struct {
+	CategoryID   uint      `json:"category_id"`
+	CategoryName string    `json:"category_name"`
+	Score        int       `json:"score"`
+	Level        *LevelDTO `json:"level"`
+	NextLevel    *LevelDTO `json:"next_level"`
+	PointsToNext int       `json:"points_to_next"`
+}
+
+// levelsByCategory returns the levels of each category, lowest first,
+// falling back to defaultLevels
+func levelsByCategory(db *gorm.DB, categoryIDs []uint) map[uint][]CategoryLevel {
+	var rows []CategoryLevel
+	if len(categoryIDs) > 0 {
+		db.Where("category_id IN ?", categoryIDs).Order("min_score").Find(&rows)
+	}
+
+	result := map[uint][]CategoryLevel{}
+	for _, l := range rows {
+		result[l.CategoryID] = append(result[l.CategoryID], l)
+	}
+	for _, id := range categoryIDs {
+		if len(result[id]) == 0 {
+			result[id] = defaultLevels
+		}
+	}
+	return result
+}
+
+func levelBadgeCode(categoryID uint, minScore int) string {
+	return fmt.Sprintf("level:%d:%d", categoryID, minScore)
+}
+
+// refreshBadges awards any level and milestone badges the user has
+// reached and not been given yet, and tells them about new ones
+func refreshBadges(db *gorm.DB, userID uint) error {
+	scores, err := levelScores(db, userID)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, 0, len(scores))
+	for _, s := range scores {
+		ids = append(ids, s.CategoryID)
+	}
+	levels := levelsByCategory(db, ids)
+
+	now := time.Now()
+	var candidates []UserBadge
+	for _, s := range scores {
+		categoryID := s.CategoryID
+		for _, l := range levels[categoryID] {
+			if s.Score >= l.MinScore {
+				candidates = append(candidates, UserBadge{
+					UserID:      userID,
+					Code:        levelBadgeCode(categoryID, l.MinScore),
+					Name:        l.Name + " " + s.CategoryName,
+					Description: fmt.Sprintf("Reached %d points in %s", l.MinScore, s.CategoryName),
+					CategoryID:  &categoryID,
+					AwardedAt:   now,
+				})
+			}
+		}
+	}
+	for _, m := range milestones {
+		reached := 0
+		for _, s := range scores {
+			if s.Score >= m.MinScore {
+				reached++
+			}
+		}
+		if reached >= m.Categories {
+			candidates = append(candidates, UserBadge{
+				UserID:      userID,
+				Code:        "milestone:" + m.Code,
+				Name:        m.Name,
+				Description: m.Description,
+				AwardedAt:   now,
+			})
+		}
+	}
+
+	for _, badge := range candidates {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&badge)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			notify(db, userID, "badge_awarded", fmt.Sprintf("You earned the \"%s\" badge", badge.Name), nil)
+		}
+	}
+	return nil
+}
+
+func toBadgeDTOs(badges []UserBadge) []BadgeDTO {
+	result := []BadgeDTO{}
+	for _, b := range badges {
+		result = append(result, BadgeDTO{
+			Code:        b.Code,
+			Name:        b.Name,
+			Description: b.Description,
+			CategoryID:  b.CategoryID,
+			AwardedAt:   b.AwardedAt,
+		})
+	}
+	return result
+}
+
+func userBadges(db *gorm.DB, userID uint) ([]BadgeDTO, error) {
+	var badges []UserBadge
+	if err := db.Where("user_id = ?", userID).Order("awarded_at desc, id desc").Find(&badges).Error; err != nil {
+		return nil, err
+	}
+	return toBadgeDTOs(badges), nil
+}
+
+// List the current user's badges, newest first
+func GetMyBadges(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		badges, err := userBadges(db, c.Locals("userID").(uint))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch badges"})
+		}
+		return c.JSON(badges)
+	}
+}
+
+// List another user's badges
+func GetUserBadges(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var user User
+		if err := db.Select("id").Where("username = ? AND suspended = ?", c.Params("username"), false).First(&user).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		badges, err := userBadges(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch badges"})
+		}
+		return c.JSON(badges)
+	}
+}
+
+// Show the current user's level in each category and what the next
+// level needs. Levels only count points that can't be taken back.
+func GetMyLevels(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		scores, err := levelScores(db, userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch achievements"})
+		}
+		ids := make([]uint, 0, len(scores))
+		for _, s := range scores {
+			ids = append(ids, s.CategoryID)
+		}
+		levels := levelsByCategory(db, ids)
+
+		result := []LevelProgressDTO{}
+		for _, s := range scores {
+			progress := LevelProgressDTO{
+				CategoryID:   s.CategoryID,
+				CategoryName: s.CategoryName,
+				Score:        s.Score,
+			}
+			for _, l := range levels[s.CategoryID] {
+				level := &LevelDTO{Name: l.Name, MinScore: l.MinScore}
+				if s.Score >= l.MinScore {
+					progress.Level = level
+					continue
+				}
+				progress.NextLevel = level
+				progress.PointsToNext = l.MinScore - s.Score
+				break
+			}
+			result = append(result, progress)
+		}
+		return c.JSON(result)
+	}
+}
+
+// List a category's levels
+func GetCategoryLevels(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var category Category
+		if err := db.First(&category, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+
+		result := []LevelDTO{}
+		for _, l := range levelsByCategory(db, []uint{category.ID})[category.ID] {
+			result = append(result, LevelDTO{Name: l.Name, MinScore: l.MinScore})
+		}
+		return c.JSON(result)
+	}
+}
+
+type UpdateLevelsRequest struct {
+	Levels []struct {
+		Name     string `json:"name" validate:"required,max=50"`
+		MinScore int    `json:"min_score" validate:"min=1"`
+	} `json:"levels" validate:"max=20,dive"`
+}
+
+// Replace a category's levels; an empty list restores the defaults
+// (admin only)
+func AdminUpdateCategoryLevels(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input UpdateLevelsRequest
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if errs := validation.Struct(&input); errs != nil {
+			return validation.Reply(c, errs)
+		}
+
+		var category Category
+		if err := db.First(&category, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+
+		levels := make([]CategoryLevel, 0, len(input.Levels))
+		seen := map[int]bool{}
+		for _, l := range input.Levels {
+			if seen[l.MinScore] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Each level needs a different min_score"})
+			}
+			seen[l.MinScore] = true
+			levels = append(levels, CategoryLevel{CategoryID: category.ID, Name: l.Name, MinScore: l.MinScore})
+		}
+		sort.Slice(levels, func(i, j int) bool { return levels[i].MinScore < levels[j].MinScore })
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("category_id = ?", category.ID).Delete(&CategoryLevel{}).Error; err != nil {
+				return err
+			}
+			if len(levels) == 0 {
+				return nil
+			}
+			return tx.Create(&levels).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update levels"})
+		}
+
+		result := []LevelDTO{}
+		for _, l := range levelsByCategory(db, []uint{category.ID})[category.ID] {
+			result = append(result, LevelDTO{Name: l.Name, MinScore: l.MinScore})
+		}
+		return c.JSON(fiber.Map{
+			"message": "Levels updated",
+			"levels":  result,
+		})
+	}
+}
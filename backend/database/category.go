@@ -1,16 +1,22 @@
 package database
 
 import (
+	"github.com/dadadun/lifskill/validation"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type Category struct {
 	gorm.Model
-	CategoriesName   string             `gorm:"size:100;not null;column:categories_name" json:"categories_name"`
-	Post             []Post             `gorm:"many2many:post_categories;"`
-	ExpertUsers      []User             `gorm:"many2many:user_expert_categories;"`
-	TotalAchievement []TotalAchievement `gorm:"many2many:Total_Achievement"`
+	CategoriesName string `gorm:"size:100;not null;column:categories_name" json:"categories_name" validate:"required,max=100"`
+	Post           []Post `gorm:"many2many:post_categories;"`
+	ExpertUsers    []User `gorm:"many2many:user_expert_categories;"`
+
+	// Approval policy, see EvaluateApproval
+	RequiredApprovals    int  `gorm:"not null;default:3" json:"required_approvals"`
+	RequireAllCategories bool `gorm:"not null;default:false" json:"require_all_categories"`
+	AutoApproveTrusted   bool `gorm:"not null;default:false" json:"auto_approve_trusted"`
+	TrustedAuthorPosts   int  `gorm:"not null;default:5" json:"trusted_author_posts"`
 }
 
 type PostCategory struct {
@@ -29,22 +35,28 @@ type UserExpertCategory struct {
 	Category Category `gorm:"foreignKey:CategoryID;references:ID"`
 }
 
-type TotalAchievement struct {
-	UserID     uint     `gorm:"primaryKey"`
-	CategoryID uint     `gorm:"primaryKey;column:Categories_id"`
-	User       User     `gorm:"foreignKey:UserID;references:ID"`
-	Category   Category `gorm:"foreignKey:CategoryID;;references:ID"`
-
-	Score int `gorm:"default:0"`
-}
-
 func CreateCategory(db *gorm.DB, c *fiber.Ctx) error {
-	category := new(Category)
-	if err := c.BodyParser(category); err != nil {
+	// Only the name; the approval policy is set by admins through
+	// AdminUpdateCategoryPolicy
+	var input struct {
+		CategoriesName string `json:"categories_name" validate:"required,max=100"`
+	}
+	if err := c.BodyParser(&input); err != nil {
 		return err
 	}
-	db.Create(&category)
-	return c.JSON(category)
+	if errs := validation.Struct(&input); errs != nil {
+		return validation.Reply(c, errs)
+	}
+	category := &Category{CategoriesName: input.CategoriesName}
+	if err := db.Create(category).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create category",
+		})
+	}
+	return c.JSON(CategoryDTO{
+		ID:             category.ID,
+		CategoriesName: category.CategoriesName,
+	})
 }
 
 // GetAllCategories fetches all categories
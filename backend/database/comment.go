@@ -1,6 +1,7 @@
 package database
 
 import (
+	"github.com/dadadun/lifskill/validation"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -16,8 +17,8 @@ type Comment struct {
 }
 
 type CreateCommentRequest struct {
-	PostID         uint   `json:"post_id"`
-	CommentContent string `json:"comment_content"`
+	PostID         uint   `json:"post_id" validate:"required"`
+	CommentContent string `json:"comment_content" validate:"required,max=2000"`
 	ParentID       *uint  `json:"parent_id"` // Optional: nil for top-level comment, or parent comment ID
 }
 
@@ -31,6 +32,9 @@ func CreateComment(db *gorm.DB) fiber.Handler {
 				"error": "Invalid comment input",
 			})
 		}
+		if errs := validation.Struct(&req); errs != nil {
+			return validation.Reply(c, errs)
+		}
 
 		// Optional: Check if post exists
 		var post Post
@@ -63,8 +67,15 @@ func CreateComment(db *gorm.DB) fiber.Handler {
 				"error": "Failed to create comment",
 			})
 		}
+		db.Preload("User").First(&comment, comment.ID)
 
-		return c.Status(fiber.StatusCreated).JSON(comment)
+		return c.Status(fiber.StatusCreated).JSON(CommentDTO{
+			ID:        comment.ID,
+			Content:   comment.CommentContent,
+			ParentID:  comment.ParentID,
+			CreatedAt: comment.CreatedAt,
+			User:      toUserDTO(comment.User),
+		})
 	}
 }
 
@@ -73,11 +84,22 @@ func GetCommentsByPostID(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		postID := c.Params("post_id")
 		var comments []Comment
-		if err := db.Where("post_id = ?", postID).Order("created_at asc").Find(&comments).Error; err != nil {
+		if err := db.Preload("User").Where("post_id = ?", postID).Order("created_at asc").Find(&comments).Error; err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to fetch comments",
 			})
 		}
-		return c.JSON(comments)
+
+		result := []CommentDTO{}
+		for _, comment := range comments {
+			result = append(result, CommentDTO{
+				ID:        comment.ID,
+				Content:   comment.CommentContent,
+				ParentID:  comment.ParentID,
+				CreatedAt: comment.CreatedAt,
+				User:      toUserDTO(comment.User),
+			})
+		}
+		return c.JSON(result)
 	}
 }
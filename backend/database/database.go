@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"log"
 	"os"
 	"time"
@@ -13,7 +14,31 @@ import (
 )
 
 var DB *gorm.DB
-var JwtSecretKey = []byte(config.AppConfig.JWTSecret)
+
+// JwtSecretKey signs access tokens. It is set by SetJWTSecret once the
+// config has loaded; until then it is empty and JWTKey fails.
+var JwtSecretKey []byte
+
+var errNoJWTSecret = errors.New("JWT secret is not set")
+
+// SetJWTSecret sets the key tokens are signed with, refusing an empty
+// secret and the public default
+func SetJWTSecret(secret string) error {
+	if secret == "" || secret == config.DefaultJWTSecret {
+		return errors.New("JWT_SECRET must be set to a private value")
+	}
+	JwtSecretKey = []byte(secret)
+	return nil
+}
+
+// JWTKey returns the access token key, failing when it was never set, so
+// tokens are never signed or checked with an empty key
+func JWTKey() ([]byte, error) {
+	if len(JwtSecretKey) == 0 {
+		return nil, errNoJWTSecret
+	}
+	return JwtSecretKey, nil
+}
 
 func ConnectDatabase() {
 	// Get DSN from config
@@ -37,26 +62,60 @@ func ConnectDatabase() {
 		panic("failed to connect to database")
 	}
 
+	// The bookmark unique index can't be built over existing duplicates
+	if err := dedupeBookmarks(DB); err != nil {
+		log.Printf("Failed to remove duplicate bookmarks: %v", err)
+	}
+
 	// Initialize GORM
 	DB.AutoMigrate(
 		&User{},
 		&Post{},
+		&PostMedia{},
+		&PostStep{},
+		&PostMaterial{},
+		&PostProgress{},
+		&StepCompletion{},
 		&Category{},
 		&PostCategory{},
 		&UserExpertCategory{},
-		&TotalAchievement{},
+		&AchievementEvent{},
+		&CategoryLevel{},
+		&UserBadge{},
+		&Follow{},
+		&FeedImpression{},
+		&Bookmark{},
 		&PostApproval{},
 		&Comment{},
 		&PostLike{},
+		&PostScore{},
+		&RequestPost{},
+		&RequestPostApproval{},
+		&Notification{},
+		&PostReview{},
+		&PostRevision{},
+		&PostRevisionReview{},
+		&Session{},
+		&AccountToken{},
 	)
 
 	// many to many relationship
 	DB.SetupJoinTable(&Post{}, "PostCategories", &PostCategory{})
 	DB.SetupJoinTable(&User{}, "ExpertCategories", &UserExpertCategory{})
-	DB.SetupJoinTable(&User{}, "TotalAchievement", &TotalAchievement{})
 	DB.SetupJoinTable(&Post{}, "PostApproval", &PostApproval{})
 	DB.SetupJoinTable(&Post{}, "PostLike", &PostLike{})
 
+	// Search queries posts.search_vector, so it can't run without it;
+	// suggestions only degrade
+	if err := setupSearch(DB); err != nil {
+		log.Fatalf("Failed to set up post search: %v", err)
+	}
+	if err := setupSuggest(DB); err != nil {
+		log.Printf("Failed to set up search suggestions: %v", err)
+	}
+
+	backfillAchievementEvents(DB)
+
 	log.Println("Database migration completed!")
 	log.Println("Database connection established successfully!")
 }
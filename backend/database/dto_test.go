@@ -0,0 +1,86 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const (
+	testHash  = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	testEmail = "author@example.com"
+)
+
+func testUser() User {
+	user := User{
+		Username: "author",
+		Password: testHash,
+		Email:    testEmail,
+		Role:     RoleExpert,
+		Picture:  "profile_pictures/abc_full.jpg",
+	}
+	user.ID = 7
+	return user
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Everything shown to other users must leave out the password hash and
+// the email address
+func TestPublicDTOsHideCredentials(t *testing.T) {
+	user := testUser()
+	post := Post{Title: "Tying knots", Status: "approved", User: user, UserID: user.ID}
+	post.ID = 3
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"User", user},
+		{"UserDTO", toUserDTO(user)},
+		{"post summary", toPostSummaryDTO(post)},
+		{"Post", post},
+		{"Comment", Comment{CommentContent: "Nice", User: user}},
+	}
+	for _, tt := range tests {
+		text := marshal(t, tt.v)
+		if strings.Contains(text, testHash) {
+			t.Errorf("%s contains the password hash: %s", tt.name, text)
+		}
+		if strings.Contains(text, testEmail) {
+			t.Errorf("%s contains the email: %s", tt.name, text)
+		}
+		if !strings.Contains(text, "author") {
+			t.Errorf("%s does not contain the user at all: %s", tt.name, text)
+		}
+	}
+}
+
+// The user's own view and the admin console show the email, but never the
+// hash
+func TestPrivateDTOsHideHash(t *testing.T) {
+	user := testUser()
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"private user", toPrivateUserDTO(user)},
+		{"admin user", toAdminUserDTO(user)},
+	}
+	for _, tt := range tests {
+		text := marshal(t, tt.v)
+		if strings.Contains(text, testHash) {
+			t.Errorf("%s contains the password hash: %s", tt.name, text)
+		}
+		if !strings.Contains(text, testEmail) {
+			t.Errorf("%s is missing the email: %s", tt.name, text)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Facets leave out their own filter, so e.g. the category counts show what
+// picking another category would return
+const (
+	facetCategory = "category"
+	facetAge      = "age"
+)
+
+// ageBuckets are the age ranges offered when creating a post
+var ageBuckets = []struct{ Min, Max int }{
+	{0, 2}, {3, 11}, {12, 14}, {15, 18}, {19, 25}, {26, 40}, {41, 55}, {56, 70}, {71, 99},
+}
+
+// PostFilter holds the filters of a faceted post search. Zero values mean
+// "don't filter".
+type PostFilter struct {
+	CategoryIDs   []uint
+	MatchAll      bool // posts must be in every category, not any
+	Age           int
+	HasAge        bool
+	CreatedFrom   time.Time
+	CreatedBefore time.Time
+	Author        string
+	HasVideo      *bool
+	MinLikes      int
+	Difficulties  []string
+}
+
+type CategoryFacetDTO struct {
+	ID             uint   `json:"id"`
+	CategoriesName string `json:"categories_name"`
+	Count          int64  `json:"count"`
+}
+
+type AgeFacetDTO struct {
+	Range string `json:"range"`
+	Count int64  `json:"count"`
+}
+
+type FacetsDTO struct {
+	Categories []CategoryFacetDTO `json:"categories"`
+	Age        []AgeFacetDTO      `json:"age"`
+}
+
+// parsePostFilter reads the filter query parameters, reporting every
+// invalid one
+func parsePostFilter(c *fiber.Ctx) (PostFilter, validation.Errors) {
+	var f PostFilter
+	var errs validation.Errors
+	invalid := func(field, message string) {
+		errs = append(errs, validation.FieldError{Field: field, Message: message})
+	}
+
+	for _, part := range splitList(c.Query("category_ids")) {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || id == 0 {
+			invalid("category_ids", "must be a comma separated list of category IDs")
+			break
+		}
+		f.CategoryIDs = append(f.CategoryIDs, uint(id))
+	}
+	switch c.Query("category_match", "any") {
+	case "any":
+	case "all":
+		f.MatchAll = true
+	default:
+		invalid("category_match", "must be one of: any all")
+	}
+
+	if age := c.Query("age"); age != "" {
+		n, err := strconv.Atoi(age)
+		if err != nil || n < 0 || n > validation.MaxAge {
+			invalid("age", fmt.Sprintf("must be a number between 0 and %d", validation.MaxAge))
+		}
+		f.Age, f.HasAge = n, true
+	}
+
+	if from := c.Query("created_from"); from != "" {
+		t, ok := parseFilterDate(from, false)
+		if !ok {
+			invalid("created_from", "must be a date (YYYY-MM-DD) or RFC 3339 time")
+		}
+		f.CreatedFrom = t
+	}
+	if to := c.Query("created_to"); to != "" {
+		t, ok := parseFilterDate(to, true)
+		if !ok {
+			invalid("created_to", "must be a date (YYYY-MM-DD) or RFC 3339 time")
+		}
+		f.CreatedBefore = t
+	}
+
+	f.Author = strings.TrimSpace(c.Query("author"))
+
+	if hasVideo := c.Query("has_video"); hasVideo != "" {
+		v, err := strconv.ParseBool(hasVideo)
+		if err != nil {
+			invalid("has_video", "must be true or false")
+		}
+		f.HasVideo = &v
+	}
+
+	if minLikes := c.Query("min_likes"); minLikes != "" {
+		n, err := strconv.Atoi(minLikes)
+		if err != nil || n < 0 {
+			invalid("min_likes", "must be a non-negative number")
+		}
+		f.MinLikes = n
+	}
+
+	for _, difficulty := range splitList(c.Query("difficulty")) {
+		switch difficulty {
+		case DifficultyBeginner, DifficultyIntermediate, DifficultyAdvanced:
+			f.Difficulties = append(f.Difficulties, difficulty)
+		default:
+			invalid("difficulty", "must be a comma separated list of: beginner intermediate advanced")
+		}
+	}
+
+	return f, errs
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseFilterDate accepts a date or an RFC 3339 time. A date used as an
+// upper bound covers the whole day.
+func parseFilterDate(s string, upper bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+// apply narrows an approved-posts query by the filter, leaving out the
+// filter behind the skip facet
+func (f PostFilter) apply(db *gorm.DB, query *gorm.DB, skip string) *gorm.DB {
+	if len(f.CategoryIDs) > 0 && skip != facetCategory {
+		inCategories := db.Table("post_categories").Select("post_id").Where("category_id IN ?", f.CategoryIDs)
+		if f.MatchAll {
+			inCategories = inCategories.Group("post_id").Having("COUNT(DISTINCT category_id) = ?", len(uniqueIDs(f.CategoryIDs)))
+		}
+		query = query.Where("posts.id IN (?)", inCategories)
+	}
+	if f.HasAge && skip != facetAge {
+		query = query.Where(ageMatchSQL, f.Age, f.Age)
+	}
+	if !f.CreatedFrom.IsZero() {
+		query = query.Where("posts.created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedBefore.IsZero() {
+		query = query.Where("posts.created_at < ?", f.CreatedBefore)
+	}
+	if f.Author != "" {
+		query = query.Where("posts.user_id IN (?)", db.Model(&User{}).Select("id").Where("username = ?", f.Author))
+	}
+	if f.HasVideo != nil {
+		videos := db.Model(&PostMedia{}).Select("post_id").Where("kind = ?", MediaVideo)
+		if *f.HasVideo {
+			query = query.Where("(posts.you_tube_link <> '' OR posts.id IN (?))", videos)
+		} else {
+			query = query.Where("(posts.you_tube_link IS NULL OR posts.you_tube_link = '') AND posts.id NOT IN (?)", videos)
+		}
+	}
+	if f.MinLikes > 0 {
+		query = query.Where(`posts."like" >= ?`, f.MinLikes)
+	}
+	if len(f.Difficulties) > 0 {
+		query = query.Where("posts.difficulty IN ?", f.Difficulties)
+	}
+	return query
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	var unique []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func approvedPosts(db *gorm.DB) *gorm.DB {
+	return db.Model(&Post{}).Where("posts.status = ?", "approved")
+}
+
+// postFacets counts the posts matching f per category and per age bucket
+func postFacets(db *gorm.DB, f PostFilter) (FacetsDTO, error) {
+	facets := FacetsDTO{Categories: []CategoryFacetDTO{}, Age: []AgeFacetDTO{}}
+
+	if err := f.apply(db, approvedPosts(db), facetCategory).
+		Select("c.id, c.categories_name, COUNT(DISTINCT posts.id) AS count").
+		Joins("JOIN post_categories pc ON pc.post_id = posts.id").
+		Joins("JOIN categories c ON c.id = pc.category_id AND c.deleted_at IS NULL").
+		Group("c.id, c.categories_name").
+		Order("count DESC, c.categories_name").
+		Scan(&facets.Categories).Error; err != nil {
+		return facets, err
+	}
+
+	// One pass over the posts: a FILTER per bucket
+	selects := make([]string, len(ageBuckets))
+	var vars []interface{}
+	for i, bucket := range ageBuckets {
+		// A post counts for every bucket its range overlaps
+		selects[i] = "COUNT(*) FILTER (WHERE " + ageMatchSQL + ")"
+		vars = append(vars, bucket.Max, bucket.Min)
+	}
+	counts := make([]int64, len(ageBuckets))
+	row := f.apply(db, approvedPosts(db), facetAge).Select(strings.Join(selects, ", "), vars...).Row()
+	dest := make([]interface{}, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	if err := row.Scan(dest...); err != nil {
+		return facets, err
+	}
+	for i, bucket := range ageBuckets {
+		facets.Age = append(facets.Age, AgeFacetDTO{
+			Range: strconv.Itoa(bucket.Min) + "-" + strconv.Itoa(bucket.Max),
+			Count: counts[i],
+		})
+	}
+
+	return facets, nil
+}
+
+// Faceted post filtering: any combination of categories (any or all of
+// them), an age matched against each post's recommended range, creation
+// dates, author, video, minimum likes and difficulty. Along with the page
+// of posts it returns counts per category and age bucket.
+func FacetedFilterPosts(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, errs := parsePostFilter(c)
+		if errs != nil {
+			return validation.Reply(c, errs)
+		}
+
+		sort := c.Query("sort") // 'mostlike', 'hot', 'trending' or 'recent'
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "10"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 50 {
+			limit = 10
+		}
+
+		var total int64
+		if err := filter.apply(db, approvedPosts(db), "").Count(&total).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to filter posts"})
+		}
+
+		query := filter.apply(db, db.Preload("User").Preload("Categories").Where("posts.status = ?", "approved"), "")
+		if scored, ok := orderByScore(query, sort); ok {
+			query = scored
+		} else if sort == "mostlike" {
+			query = query.Order(`posts."like" DESC, posts.created_at DESC`)
+		} else {
+			query = query.Order("posts.created_at DESC")
+		}
+
+		var posts []Post
+		if err := query.Limit(limit).Offset((page - 1) * limit).Find(&posts).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to filter posts"})
+		}
+
+		facets, err := postFacets(db, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count facets"})
+		}
+
+		postDTOs := []PostDTO{}
+		for _, post := range posts {
+			postDTOs = append(postDTOs, toPostSummaryDTO(post))
+		}
+
+		return c.JSON(fiber.Map{
+			"posts":  postDTOs,
+			"total":  total,
+			"page":   page,
+			"limit":  limit,
+			"facets": facets,
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseQuery runs parsePostFilter on a request with the given query
+func parseQuery(t *testing.T, query url.Values) (PostFilter, validation.Errors) {
+	t.Helper()
+	var f PostFilter
+	var errs validation.Errors
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		f, errs = parsePostFilter(c)
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest("GET", "/?"+query.Encode(), nil)); err != nil {
+		t.Fatal(err)
+	}
+	return f, errs
+}
+
+func errorFields(errs validation.Errors) []string {
+	var fields []string
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	return fields
+}
+
+func TestParsePostFilter(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name  string
+		query url.Values
+		want  PostFilter
+	}{
+		{"no filters", url.Values{}, PostFilter{}},
+		{"categories", url.Values{"category_ids": {"3, 1,,3"}}, PostFilter{CategoryIDs: []uint{3, 1, 3}}},
+		{"match all categories", url.Values{"category_ids": {"1,2"}, "category_match": {"all"}}, PostFilter{CategoryIDs: []uint{1, 2}, MatchAll: true}},
+		{"age", url.Values{"age": {"0"}}, PostFilter{HasAge: true}},
+		{"author is trimmed", url.Values{"author": {" dan "}}, PostFilter{Author: "dan"}},
+		{"has video", url.Values{"has_video": {"true"}}, PostFilter{HasVideo: &yes}},
+		{"min likes", url.Values{"min_likes": {"5"}}, PostFilter{MinLikes: 5}},
+		{"difficulties", url.Values{"difficulty": {"beginner,advanced"}}, PostFilter{Difficulties: []string{"beginner", "advanced"}}},
+		{
+			"created range by day",
+			url.Values{"created_from": {"2024-05-01"}, "created_to": {"2024-05-03"}},
+			PostFilter{
+				CreatedFrom:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				CreatedBefore: time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"created range by time",
+			url.Values{"created_from": {"2024-05-01T08:00:00Z"}, "created_to": {"2024-05-03T08:00:00Z"}},
+			PostFilter{
+				CreatedFrom:   time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+				CreatedBefore: time.Date(2024, 5, 3, 8, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := parseQuery(t, tt.query)
+			if errs != nil {
+				t.Fatalf("expected no errors, got %v", errs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePostFilterReportsEveryField(t *testing.T) {
+	_, errs := parseQuery(t, url.Values{
+		"category_ids":   {"1,x"},
+		"category_match": {"some"},
+		"age":            {"200"},
+		"created_from":   {"yesterday"},
+		"created_to":     {"2024-13-01"},
+		"has_video":      {"maybe"},
+		"min_likes":      {"-1"},
+		"difficulty":     {"easy"},
+	})
+	want := []string{"category_ids", "category_match", "age", "created_from", "created_to", "has_video", "min_likes", "difficulty"}
+	if got := errorFields(errs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got errors for %v, want %v", got, want)
+	}
+}
+
+func TestParseFilterDate(t *testing.T) {
+	tests := []struct {
+		in    string
+		upper bool
+		want  time.Time
+		ok    bool
+	}{
+		{"2024-05-01", false, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2024-05-01", true, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), true},
+		{"2024-12-31", true, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2024-05-01T10:00:00+07:00", true, time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC), true},
+		{"2024-02-30", false, time.Time{}, false},
+		{"05/01/2024", false, time.Time{}, false},
+		{"", true, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseFilterDate(tt.in, tt.upper)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseFilterDate(%q, %v) = %v, %v; want %v, %v", tt.in, tt.upper, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := map[string][]string{
+		"":          nil,
+		" , ,":      nil,
+		"a":         {"a"},
+		" a , b,,c": {"a", "b", "c"},
+	}
+	for in, want := range tests {
+		if got := splitList(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitList(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestUniqueIDs(t *testing.T) {
+	// category_match=all compares against this count, so repeated IDs
+	// must not be counted twice
+	got := uniqueIDs([]uint{3, 1, 3, 2, 1})
+	if want := []uint{3, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Why a post is in someone's feed
+const (
+	ReasonFollowing = "following"
+	ReasonCategory  = "achieved_category"
+	ReasonAge       = "age"
+	ReasonTrending  = "trending"
+)
+
+// trendingFeedSize is how many trending posts are mixed into every feed
+const trendingFeedSize = 50
+
+// feedImpressionTTL is how long a seen post stays out of the feed.
+// Older impressions are pruned whenever the user reports new ones.
+const feedImpressionTTL = 30 * 24 * time.Hour
+
+// FeedImpression records that the user viewed a post from their feed, so
+// later feed loads can skip it
+type FeedImpression struct {
+	UserID uint      `gorm:"primaryKey"`
+	PostID uint      `gorm:"primaryKey"`
+	SeenAt time.Time `gorm:"not null"`
+}
+
+type FeedSeenRequest struct {
+	PostIDs []uint `json:"post_ids" validate:"required,max=50"`
+}
+
+type FeedItemDTO struct {
+	Post    PostDTO  `json:"post"`
+	Reasons []string `json:"reasons"`
+}
+
+// ageMatchSQL matches posts whose "min-max" RecommendAgeRange contains
+// the given age (passed twice), or with (max, min) overlaps that range.
+// Malformed ranges never match. Ranges saved before validation capped
+// ages can hold any number, so the pattern bounds the digits and the
+// casts use bigint; one such post can't break the query for everyone.
+const ageMatchSQL = `CASE WHEN posts.recommend_age_range ~ '^\s*\d{1,9}\s*-\s*\d{1,9}\s*$'
+	THEN trim(split_part(posts.recommend_age_range, '-', 1))::bigint <= ?
+		AND trim(split_part(posts.recommend_age_range, '-', 2))::bigint >= ?
+	ELSE false END`
+
+// trendingPostIDs selects the IDs of the posts with the best trending score
+func trendingPostIDs(db *gorm.DB, limit int) *gorm.DB {
+	return db.Model(&PostScore{}).
+		Select("post_id").
+		Where("trending > 0").
+		Order("trending DESC, post_id DESC").
+		Limit(limit)
+}
+
+// Feed cursors point at the last post returned: "<created_at>:<id>"
+func encodeFeedCursor(post Post) string {
+	raw := fmt.Sprintf("%d:%d", post.CreatedAt.UnixNano(), post.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFeedCursor(cursor string) (time.Time, uint, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, 0, false
+	}
+	n, err1 := strconv.ParseInt(nanos, 10, 64)
+	i, err2 := strconv.ParseUint(id, 10, 64)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, 0, false
+	}
+	return time.Unix(0, n), uint(i), true
+}
+
+// Personalized feed: posts by followed authors, in categories the user
+// has achieved in, recommended for their age, and trending posts. Each
+// post appears once, newest first, with the reasons it was picked. Posts
+// the client reported as seen through MarkFeedSeen in the last 30 days
+// are skipped unless include_seen=true; loading the feed alone marks
+// nothing, so a refresh doesn't hide posts nobody looked at.
+func GetFeed(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+		if limit < 1 || limit > 50 {
+			limit = 20
+		}
+
+		var user User
+		if err := db.Select("id", "age").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		followed := db.Model(&Follow{}).Select("followee_id").Where("follower_id = ?", userID)
+		achieved := db.Model(&AchievementEvent{}).
+			Select("category_id").
+			Where("user_id = ?", userID).
+			Group("category_id").
+			Having("SUM(points) > 0")
+		inAchieved := db.Table("post_categories").Select("post_id").Where("category_id IN (?)", achieved)
+		trending := trendingPostIDs(db, trendingFeedSize)
+
+		sources := db.Where("posts.user_id IN (?)", followed).
+			Or("posts.id IN (?)", inAchieved).
+			Or("posts.id IN (?)", trending)
+		if user.Age > 0 {
+			sources = sources.Or(ageMatchSQL, user.Age, user.Age)
+		}
+
+		query := db.Preload("User").Preload("Categories").
+			Where("posts.status = ? AND posts.user_id <> ?", "approved", userID).
+			Where(sources)
+		if c.Query("include_seen") != "true" {
+			query = query.Where("posts.id NOT IN (?)",
+				db.Model(&FeedImpression{}).Select("post_id").
+					Where("user_id = ? AND seen_at >= ?", userID, time.Now().Add(-feedImpressionTTL)))
+		}
+		if cursor := c.Query("cursor"); cursor != "" {
+			createdAt, id, ok := decodeFeedCursor(cursor)
+			if !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+			}
+			query = query.Where("(posts.created_at, posts.id) < (?, ?)", createdAt, id)
+		}
+
+		var posts []Post
+		if err := query.Order("posts.created_at DESC, posts.id DESC").
+			Limit(limit + 1).
+			Find(&posts).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch feed"})
+		}
+
+		var nextCursor *string
+		if len(posts) > limit {
+			posts = posts[:limit]
+			cursor := encodeFeedCursor(posts[len(posts)-1])
+			nextCursor = &cursor
+		}
+
+		// Work out why each post was picked
+		var followedIDs, achievedIDs, trendingIDs []uint
+		followed.Pluck("followee_id", &followedIDs)
+		achieved.Pluck("category_id", &achievedIDs)
+		trending.Pluck("post_id", &trendingIDs)
+		isFollowed := toSet(followedIDs)
+		isAchieved := toSet(achievedIDs)
+		isTrending := toSet(trendingIDs)
+
+		items := []FeedItemDTO{}
+		for _, post := range posts {
+			reasons := []string{}
+			if isFollowed[post.UserID] {
+				reasons = append(reasons, ReasonFollowing)
+			}
+			for _, cat := range post.Categories {
+				if isAchieved[cat.ID] {
+					reasons = append(reasons, ReasonCategory)
+					break
+				}
+			}
+			if minAge, maxAge, ok := validation.ParseAgeRange(post.RecommendAgeRange); ok && user.Age > 0 &&
+				user.Age >= minAge && user.Age <= maxAge {
+				reasons = append(reasons, ReasonAge)
+			}
+			if isTrending[post.ID] {
+				reasons = append(reasons, ReasonTrending)
+			}
+
+			items = append(items, FeedItemDTO{Post: toPostSummaryDTO(post), Reasons: reasons})
+		}
+
+		return c.JSON(fiber.Map{
+			"items":       items,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+// Mark feed posts as seen, e.g. once the client has shown them on screen,
+// so the next feed load skips them
+func MarkFeedSeen(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		input := new(FeedSeenRequest)
+		if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if errs := validation.Struct(input); errs != nil {
+			return validation.Reply(c, errs)
+		}
+
+		var postIDs []uint
+		if err := db.Model(&Post{}).Where("id IN ?", input.PostIDs).Pluck("id", &postIDs).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark posts as seen"})
+		}
+
+		now := time.Now()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ? AND seen_at < ?", userID, now.Add(-feedImpressionTTL)).
+				Delete(&FeedImpression{}).Error; err != nil {
+				return err
+			}
+			if len(postIDs) == 0 {
+				return nil
+			}
+			impressions := make([]FeedImpression, 0, len(postIDs))
+			for _, id := range postIDs {
+				impressions = append(impressions, FeedImpression{UserID: userID, PostID: id, SeenAt: now})
+			}
+			// Seeing a post again restarts its TTL
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "post_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"seen_at"}),
+			}).Create(&impressions).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark posts as seen"})
+		}
+
+		return c.JSON(fiber.Map{"seen": len(postIDs)})
+	}
+}
+
+func toSet(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestFeedCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 123456789, time.UTC)
+	post := Post{}
+	post.ID = 42
+	post.CreatedAt = created
+
+	at, id, ok := decodeFeedCursor(encodeFeedCursor(post))
+	if !ok {
+		t.Fatal("expected the cursor to decode")
+	}
+	if !at.Equal(created) || id != 42 {
+		t.Fatalf("got (%v, %d), want (%v, 42)", at, id, created)
+	}
+}
+
+func TestDecodeFeedCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"malformed base64", "not base64!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("1:23"))},
+		{"missing colon", encode("1714559400000000000")},
+		{"time not a number", encode("yesterday:42")},
+		{"id not a number", encode("1714559400000000000:abc")},
+		{"negative id", encode("1714559400000000000:-1")},
+		{"missing id", encode("1714559400000000000:")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := decodeFeedCursor(tt.cursor); ok {
+				t.Fatalf("expected %q to be rejected", tt.cursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Follow means Follower sees Followee's posts in their feed
+type Follow struct {
+	FollowerID uint      `gorm:"primaryKey"`
+	FolloweeID uint      `gorm:"primaryKey;index"`
+	CreatedAt  time.Time `gorm:"not null"`
+
+	Follower User `gorm:"foreignKey:FollowerID;references:ID"`
+	Followee User `gorm:"foreignKey:FolloweeID;references:ID"`
+}
+
+// followCounts returns how many users follow userID and how many it
+// follows, leaving out deleted and suspended users
+func followCounts(db *gorm.DB, userID uint) (followers, following int64) {
+	countFollows(db, "f.followee_id", "f.follower_id", userID).Count(&followers)
+	countFollows(db, "f.follower_id", "f.followee_id", userID).Count(&following)
+	return followers, following
+}
+
+// countFollows selects the follows whose match column is userID and whose
+// other end is an active user
+func countFollows(db *gorm.DB, match, other string, userID uint) *gorm.DB {
+	return db.Table("follows f").
+		Joins("JOIN users u ON u.id = "+other+" AND u.deleted_at IS NULL AND u.suspended = ?", false).
+		Where(match+" = ?", userID)
+}
+
+// findFollowTarget loads the active user named in the :username param
+func findFollowTarget(db *gorm.DB, c *fiber.Ctx) (User, bool) {
+	var user User
+	err := db.Where("username = ? AND suspended = ?", c.Params("username"), false).First(&user).Error
+	return user, err == nil
+}
+
+// Follow a user
+func FollowUser(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		target, ok := findFollowTarget(db, c)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		if target.ID == userID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot follow yourself"})
+		}
+
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Follow{
+			FollowerID: userID,
+			FolloweeID: target.ID,
+			CreatedAt:  time.Now(),
+		})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to follow user"})
+		}
+		if result.RowsAffected == 1 {
+			var follower User
+			if db.Select("id", "username").First(&follower, userID).Error == nil {
+				notify(db, target.ID, "new_follower", fmt.Sprintf("%s started following you", follower.Username), nil)
+			}
+		}
+
+		followers, _ := followCounts(db, target.ID)
+		return c.JSON(fiber.Map{
+			"message":         "Following " + target.Username,
+			"following":       true,
+			"followers_count": followers,
+		})
+	}
+}
+
+// Unfollow a user
+func UnfollowUser(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var target User
+		if err := db.Where("username = ?", c.Params("username")).First(&target).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		if err := db.Where("follower_id = ? AND followee_id = ?", userID, target.ID).Delete(&Follow{}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unfollow user"})
+		}
+
+		followers, _ := followCounts(db, target.ID)
+		return c.JSON(fiber.Map{
+			"message":         "Unfollowed " + target.Username,
+			"following":       false,
+			"followers_count": followers,
+		})
+	}
+}
+
+// listFollows pages through one side of a user's follows: their followers
+// or the users they follow, most recent first
+func listFollows(db *gorm.DB, followers bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		target, ok := findFollowTarget(db, c)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		// Join the user on the other end of each follow, skipping deleted
+		// and suspended ones
+		match, other := "f.followee_id", "f.follower_id"
+		if !followers {
+			match, other = "f.follower_id", "f.followee_id"
+		}
+
+		var users []User
+		var total int64
+		countFollows(db, match, other, target.ID).Count(&total)
+		if err := db.Joins("JOIN follows f ON users.id = "+other).
+			Where(match+" = ? AND users.suspended = ?", target.ID, false).
+			Order("f.created_at desc").
+			Limit(limit).
+			Offset((page - 1) * limit).
+			Find(&users).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch follows"})
+		}
+
+		result := []UserDTO{}
+		for _, u := range users {
+			result = append(result, toUserDTO(u))
+		}
+		return c.JSON(fiber.Map{
+			"users": result,
+			"total": total,
+			"page":  page,
+		})
+	}
+}
+
+// List the users following someone
+func GetFollowers(db *gorm.DB) fiber.Handler {
+	return listFollows(db, true)
+}
+
+// List the users someone follows
+func GetFollowing(db *gorm.DB) fiber.Handler {
+	return listFollows(db, false)
+}
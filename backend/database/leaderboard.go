@@ -0,0 +1,133 @@
+package database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Leaderboard windows. Week and month are rolling: the last 7 and 30 days.
+const (
+	WindowWeek  = "week"
+	WindowMonth = "month"
+	WindowAll   = "all"
+)
+
+type LeaderboardEntryDTO struct {
+	Rank  int     `json:"rank"`
+	User  UserDTO `json:"user"`
+	Score int     `json:"score"`
+}
+
+// windowStart returns when a window begins, or nil for all time
+func windowStart(window string) (*time.Time, bool) {
+	var since time.Time
+	switch window {
+	case WindowAll:
+		return nil, true
+	case WindowWeek:
+		since = time.Now().AddDate(0, 0, -7)
+	case WindowMonth:
+		since = time.Now().AddDate(0, 0, -30)
+	default:
+		return nil, false
+	}
+	return &since, true
+}
+
+// leaderboard ranks users by points earned in the window, optionally in
+// one category. Suspended users, users who opted out and deleted
+// categories are left out, as in categoryScores. The sums run on the
+// (category_id, created_at) and created_at indexes of achievement_events.
+func leaderboard(db *gorm.DB, categoryID uint, since *time.Time, limit, offset int) ([]LeaderboardEntryDTO, error) {
+	query := db.Table("achievement_events e").
+		Select("e.user_id AS id, u.username, u.picture, SUM(e.points) AS score").
+		Joins("JOIN users u ON u.id = e.user_id AND u.deleted_at IS NULL").
+		Joins("JOIN categories c ON c.id = e.category_id AND c.deleted_at IS NULL").
+		Where("u.hide_from_leaderboards = ? AND u.suspended = ?", false, false)
+	if categoryID != 0 {
+		query = query.Where("e.category_id = ?", categoryID)
+	}
+	if since != nil {
+		// Merge transfers and legacy scores are dated when they were
+		// written, not when the points were earned, so they only count
+		// towards all time
+		query = query.Where("e.created_at >= ? AND e.source NOT IN ?",
+			*since, []string{SourceCategoryMerged, SourceLegacy})
+	}
+
+	var rows []struct {
+		ID       uint
+		Username string
+		Picture  string
+		Score    int
+	}
+	if err := query.Group("e.user_id, u.username, u.picture").
+		Having("SUM(e.points) > 0").
+		Order("score DESC, e.user_id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	entries := []LeaderboardEntryDTO{}
+	for i, r := range rows {
+		entries = append(entries, LeaderboardEntryDTO{
+			Rank:  offset + i + 1,
+			User:  toUserDTO(User{Model: gorm.Model{ID: r.ID}, Username: r.Username, Picture: r.Picture}),
+			Score: r.Score,
+		})
+	}
+	return entries, nil
+}
+
+func leaderboardHandler(db *gorm.DB, c *fiber.Ctx, categoryID uint) error {
+	window := c.Query("window", WindowAll)
+	since, ok := windowStart(window)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "window must be one of: week, month, all"})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	entries, err := leaderboard(db, categoryID, since, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch leaderboard"})
+	}
+
+	return c.JSON(fiber.Map{
+		"window":      window,
+		"since":       since,
+		"category_id": categoryID,
+		"page":        page,
+		"entries":     entries,
+	})
+}
+
+// Rank users across all categories
+func GetGlobalLeaderboard(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return leaderboardHandler(db, c, 0)
+	}
+}
+
+// Rank users within one category
+func GetCategoryLeaderboard(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var category Category
+		if err := db.First(&category, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+		return leaderboardHandler(db, c, category.ID)
+	}
+}
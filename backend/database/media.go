@@ -0,0 +1,261 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/dadadun/lifskill/config"
+	"github.com/dadadun/lifskill/imaging"
+	"github.com/dadadun/lifskill/storage"
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Attachment kinds
+const (
+	MediaImage = "image"
+	MediaPDF   = "pdf"
+	MediaVideo = "video"
+)
+
+// MaxPostMedia is how many attachments a single post may carry
+const MaxPostMedia = 20
+
+// PostMedia is one attachment of a post: a step photo, a PDF handout or a
+// short video. Attachments are shown in Position order.
+type PostMedia struct {
+	gorm.Model
+	PostID      uint   `gorm:"not null;index"`
+	Position    int    `gorm:"not null"`
+	Kind        string `gorm:"size:10;not null"`
+	Key         string `gorm:"size:255;not null"`
+	ContentType string `gorm:"size:100"`
+	Size        int64
+	Caption     string `gorm:"size:300"`
+}
+
+type PostMediaDTO struct {
+	ID       uint               `json:"id"`
+	Position int                `json:"position"`
+	Kind     string             `json:"kind"`
+	Caption  string             `json:"caption"`
+	URL      string             `json:"url"`
+	Image    *storage.ImageURLs `json:"image,omitempty"` // sizes, for images only
+}
+
+func toPostMediaDTOs(media []PostMedia) []PostMediaDTO {
+	result := []PostMediaDTO{}
+	for _, m := range media {
+		dto := PostMediaDTO{
+			ID:       m.ID,
+			Position: m.Position,
+			Kind:     m.Kind,
+			Caption:  m.Caption,
+			URL:      storage.URL(m.Key),
+		}
+		if m.Kind == MediaImage {
+			dto.Image = storage.ImageURLsFor(m.Key)
+		}
+		result = append(result, dto)
+	}
+	return result
+}
+
+// byPosition orders a post's attachments, steps or materials for display
+func byPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+var errUnsupportedAttachment = errors.New("unsupported attachment type")
+
+// Attachment types other than images, by sniffed content type
+var attachmentTypes = map[string]struct{ kind, ext string }{
+	"application/pdf": {MediaPDF, ".pdf"},
+	"video/mp4":       {MediaVideo, ".mp4"},
+	"video/webm":      {MediaVideo, ".webm"},
+}
+
+// saveAttachment stores one uploaded file. Images go through the resizing
+// pipeline; PDFs and videos are stored as they are.
+func saveAttachment(store storage.Storage, file *multipart.FileHeader) (PostMedia, error) {
+	f, err := file.Open()
+	if err != nil {
+		return PostMedia{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	contentType := http.DetectContentType(head[:n])
+
+	if strings.HasPrefix(contentType, "image/") {
+		key, err := storage.SaveImage(store, file, "posts")
+		if err != nil {
+			return PostMedia{}, err
+		}
+		return PostMedia{Kind: MediaImage, Key: key, ContentType: contentType, Size: file.Size}, nil
+	}
+
+	t, ok := attachmentTypes[contentType]
+	if !ok {
+		return PostMedia{}, errUnsupportedAttachment
+	}
+	limitMB := config.AppConfig.MaxUploadMB
+	if t.kind == MediaVideo {
+		limitMB = config.AppConfig.MaxVideoMB
+	}
+	if file.Size > int64(limitMB)<<20 {
+		return PostMedia{}, imaging.ErrTooLarge
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return PostMedia{}, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return PostMedia{}, err
+	}
+	key, err := storage.SaveBytes(store, data, "attachments", t.ext)
+	if err != nil {
+		return PostMedia{}, err
+	}
+	return PostMedia{Kind: t.kind, Key: key, ContentType: contentType, Size: file.Size}, nil
+}
+
+// saveAttachments stores the files sent as "media" with their "captions"
+// (matched by position) and returns them in order. On error it still
+// returns the files stored so far, so the caller can release them.
+func saveAttachments(c *fiber.Ctx, store storage.Storage) ([]PostMedia, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, nil
+	}
+	files := form.File["media"]
+	captions := form.Value["captions"]
+
+	if len(files) > MaxPostMedia {
+		return nil, validation.Errors{{
+			Field:   "media",
+			Message: fmt.Sprintf("must have at most %d files", MaxPostMedia),
+		}}
+	}
+	var errs validation.Errors
+	for i, caption := range captions {
+		if len([]rune(caption)) > 300 {
+			errs = append(errs, validation.FieldError{
+				Field:   fmt.Sprintf("captions[%d]", i),
+				Message: "must be at most 300 characters",
+			})
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	media := make([]PostMedia, 0, len(files))
+	for i, file := range files {
+		m, err := saveAttachment(store, file)
+		if err != nil {
+			return media, &attachmentError{name: file.Filename, err: err}
+		}
+		m.Position = i
+		if i < len(captions) {
+			m.Caption = strings.TrimSpace(captions[i])
+		}
+		media = append(media, m)
+	}
+	return media, nil
+}
+
+// uploadRefs are the columns that hold storage keys. Soft-deleted rows
+// count too, since they can be restored.
+var uploadRefs = []struct {
+	model interface{}
+	where string
+}{
+	{&User{}, "picture = ?"},
+	{&Post{}, "picture = ?"},
+	{&PostRevision{}, "picture = ?"},
+	{&PostRevision{}, "tutorial LIKE '%\"' || ? || '\"%'"}, // step pictures in the JSON
+	{&RequestPost{}, "picture = ?"},
+	{&PostStep{}, "picture = ?"},
+	{&PostMedia{}, "key = ?"},
+}
+
+// releaseUploads deletes stored files that no record uses any more, e.g.
+// after a failed create or a replaced picture. Identical uploads share a
+// key, so a key still referenced anywhere is kept. Failures are only
+// logged; an orphaned file is harmless.
+func releaseUploads(db *gorm.DB, store storage.Storage, keys ...string) {
+	for _, key := range keys {
+		if key == "" || strings.Contains(key, "://") || strings.HasPrefix(key, "./") {
+			continue // remote URLs and files from before storage keys
+		}
+		used := false
+		for _, ref := range uploadRefs {
+			var count int64
+			db.Unscoped().Model(ref.model).Where(ref.where, key).Count(&count)
+			if count > 0 {
+				used = true
+				break
+			}
+		}
+		if used {
+			continue
+		}
+		if err := storage.DeleteImage(store, key); err != nil {
+			log.Printf("Failed to delete unused upload %s: %v", key, err)
+		}
+	}
+}
+
+// mediaKeys lists the storage keys of attachments
+func mediaKeys(media []PostMedia) []string {
+	keys := make([]string, 0, len(media))
+	for _, m := range media {
+		keys = append(keys, m.Key)
+	}
+	return keys
+}
+
+type attachmentError struct {
+	name string
+	err  error
+}
+
+func (e *attachmentError) Error() string { return e.name + ": " + e.err.Error() }
+func (e *attachmentError) Unwrap() error { return e.err }
+
+// mediaError answers a failed saveAttachments call
+func mediaError(c *fiber.Ctx, err error) error {
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		return validation.Reply(c, errs)
+	}
+
+	name := "Attachment"
+	var ae *attachmentError
+	if errors.As(err, &ae) {
+		name = ae.name
+	}
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("%s is too large (images and PDFs up to %d MB, videos up to %d MB)",
+				name, config.AppConfig.MaxUploadMB, config.AppConfig.MaxVideoMB),
+		})
+	case errors.Is(err, imaging.ErrUnsupportedType), errors.Is(err, errUnsupportedAttachment):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": name + " must be a JPEG, PNG or GIF image, a PDF, or an MP4 or WebM video",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to save attachment: " + err.Error(),
+	})
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// outranks reports whether actor has a strictly higher role than target
+func outranks(actor, target string) bool {
+	return RoleAtLeast(actor, target) && !RoleAtLeast(target, actor)
+}
+
+// Take down a post (moderator or admin)
+func TakeDownPost(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		postID := c.Params("id")
+
+		var post Post
+		if err := db.First(&post, postID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+
+		post.Status = "removed"
+		if err := db.Save(&post).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to take down post"})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Post taken down",
+			"status":  post.Status,
+		})
+	}
+}
+
+// Suspend or unsuspend a user account (moderator or admin)
+func SetUserSuspended(db *gorm.DB, suspended bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actorID := c.Locals("userID").(uint)
+		actorRole, _ := c.Locals("role").(string)
+		targetID := c.Params("id")
+
+		var user User
+		if err := db.First(&user, targetID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		if user.ID == actorID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot suspend yourself"})
+		}
+
+		// Moderators can only act on members and experts
+		if !outranks(actorRole, user.Role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot change the status of this user"})
+		}
+
+		if err := db.Model(&user).Update("suspended", suspended).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user"})
+		}
+		if suspended {
+			RevokeUserSessions(db, user.ID, 0)
+		}
+
+		return c.JSON(fiber.Map{
+			"message":   "User updated",
+			"user_id":   user.ID,
+			"suspended": suspended,
+		})
+	}
+}
+
+// Change a user's role (admin only)
+func SetUserRole(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actorID := c.Locals("userID").(uint)
+		targetID := c.Params("id")
+
+		var input struct {
+			Role string `json:"role"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if !IsValidRole(input.Role) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown role"})
+		}
+
+		var user User
+		if err := db.First(&user, targetID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		if user.ID == actorID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot change your own role"})
+		}
+
+		if err := db.Model(&user).Update("role", input.Role).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update role"})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Role updated",
+			"user_id": user.ID,
+			"role":    input.Role,
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type Notification struct {
+	gorm.Model
+	UserID  uint       `gorm:"not null;index"`
+	Type    string     `gorm:"size:50;not null"`
+	Message string     `gorm:"size:255;not null"`
+	PostID  *uint      `gorm:"default:null"`
+	ReadAt  *time.Time `gorm:"default:null"`
+	User    User       `gorm:"foreignKey:UserID;references:ID"`
+}
+
+type NotificationDTO struct {
+	ID        uint      `json:"id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	PostID    *uint     `json:"post_id"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// notify stores a notification for a user; failures are not fatal to the caller
+func notify(db *gorm.DB, userID uint, kind, message string, postID *uint) {
+	db.Create(&Notification{
+		UserID:  userID,
+		Type:    kind,
+		Message: message,
+		PostID:  postID,
+	})
+}
+
+// Get current user's notifications, newest first
+func GetMyNotifications(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		query := db.Where("user_id = ?", userID)
+		if c.Query("unread") == "true" {
+			query = query.Where("read_at IS NULL")
+		}
+
+		var notifications []Notification
+		if err := query.Order("created_at desc").Limit(100).Find(&notifications).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch notifications"})
+		}
+
+		result := []NotificationDTO{}
+		for _, n := range notifications {
+			result = append(result, NotificationDTO{
+				ID:        n.ID,
+				Type:      n.Type,
+				Message:   n.Message,
+				PostID:    n.PostID,
+				Read:      n.ReadAt != nil,
+				CreatedAt: n.CreatedAt,
+			})
+		}
+		return c.JSON(result)
+	}
+}
+
+// Mark one of the current user's notifications as read
+func MarkNotificationRead(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var notification Notification
+		if err := db.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&notification).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+		}
+
+		if notification.ReadAt == nil {
+			now := time.Now()
+			if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update notification"})
+			}
+		}
+
+		return c.JSON(fiber.Map{"message": "Notification marked as read"})
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Used when a post has no categories or a category has no policy set
+const DefaultRequiredApprovals = 3
+
+// ApprovalPolicy is the effective review policy of a post, combined from
+// the policies of all its categories
+type ApprovalPolicy struct {
+	RequiredApprovals    int  `json:"required_approvals"`
+	RequireAllCategories bool `json:"require_all_categories"`
+}
+
+// approvalPolicyFor combines category policies: the strictest required
+// count wins, and coverage is required if any category asks for it
+func approvalPolicyFor(categories []Category) ApprovalPolicy {
+	policy := ApprovalPolicy{}
+	for _, cat := range categories {
+		if cat.RequiredApprovals > policy.RequiredApprovals {
+			policy.RequiredApprovals = cat.RequiredApprovals
+		}
+		if cat.RequireAllCategories {
+			policy.RequireAllCategories = true
+		}
+	}
+	if policy.RequiredApprovals < 1 {
+		policy.RequiredApprovals = DefaultRequiredApprovals
+	}
+	return policy
+}
+
+// EvaluateApproval decides whether the given expert approvals are enough to
+// approve content in the given categories. It is shared by posts, request
+// posts and post revisions.
+func EvaluateApproval(db *gorm.DB, categories []Category, approverIDs []uint) (bool, ApprovalPolicy) {
+	policy := approvalPolicyFor(categories)
+	if len(approverIDs) < policy.RequiredApprovals {
+		return false, policy
+	}
+
+	if policy.RequireAllCategories {
+		// Every category needs at least one approver who is an expert in it
+		for _, cat := range categories {
+			var count int64
+			db.Model(&UserExpertCategory{}).
+				Where("category_id = ? AND user_id IN ?", cat.ID, approverIDs).
+				Count(&count)
+			if count == 0 {
+				return false, policy
+			}
+		}
+	}
+	return true, policy
+}
+
+// isTrustedAuthor reports whether a new post by the author can skip review:
+// every category must allow auto-approval, and in each the author must
+// already have enough approved posts. Expert categories don't count, since
+// members pick those themselves.
+func isTrustedAuthor(db *gorm.DB, categories []Category, authorID uint) bool {
+	if len(categories) == 0 {
+		return false
+	}
+	for _, cat := range categories {
+		if !cat.AutoApproveTrusted {
+			return false
+		}
+
+		var approvedCount int64
+		db.Model(&Post{}).
+			Joins("JOIN post_categories pc ON pc.post_id = posts.id").
+			Where("pc.category_id = ? AND posts.user_id = ? AND posts.status = ?", cat.ID, authorID, "approved").
+			Count(&approvedCount)
+		if cat.TrustedAuthorPosts < 1 || approvedCount < int64(cat.TrustedAuthorPosts) {
+			return false
+		}
+	}
+	return true
+}
+
+// Update a category's approval policy (admin only)
+func AdminUpdateCategoryPolicy(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input struct {
+			RequiredApprovals    *int  `json:"required_approvals"`
+			RequireAllCategories *bool `json:"require_all_categories"`
+			AutoApproveTrusted   *bool `json:"auto_approve_trusted"`
+			TrustedAuthorPosts   *int  `json:"trusted_author_posts"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+
+		var category Category
+		if err := db.First(&category, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+		}
+
+		updates := map[string]interface{}{}
+		if input.RequiredApprovals != nil {
+			if *input.RequiredApprovals < 1 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "required_approvals must be at least 1"})
+			}
+			updates["required_approvals"] = *input.RequiredApprovals
+			category.RequiredApprovals = *input.RequiredApprovals
+		}
+		if input.RequireAllCategories != nil {
+			updates["require_all_categories"] = *input.RequireAllCategories
+			category.RequireAllCategories = *input.RequireAllCategories
+		}
+		if input.AutoApproveTrusted != nil {
+			updates["auto_approve_trusted"] = *input.AutoApproveTrusted
+			category.AutoApproveTrusted = *input.AutoApproveTrusted
+		}
+		if input.TrustedAuthorPosts != nil {
+			if *input.TrustedAuthorPosts < 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "trusted_author_posts cannot be negative"})
+			}
+			updates["trusted_author_posts"] = *input.TrustedAuthorPosts
+			category.TrustedAuthorPosts = *input.TrustedAuthorPosts
+		}
+
+		if len(updates) > 0 {
+			if err := db.Model(&category).Updates(updates).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update policy"})
+			}
+		}
+
+		return c.JSON(category)
+	}
+}
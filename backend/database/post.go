@@ -2,13 +2,19 @@ package database
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/dadadun/lifskill/config"
+	"github.com/dadadun/lifskill/imaging"
+	"github.com/dadadun/lifskill/storage"
+	"github.com/dadadun/lifskill/validation"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Post struct {
@@ -23,10 +29,15 @@ type Post struct {
 	ApprovedUsers     int    `gorm:"default:0;column:Total_Approved_Users"`
 	UserID            uint   `gorm:"not null"`
 	User              User   `gorm:"foreignKey:UserID;references:ID"`
+	PendingRevisionID *uint  `gorm:"default:null"` // edit awaiting expert review
+	Difficulty        string `gorm:"size:20"`      // optional, see DifficultyBeginner
 
 	Categories   []Category     `gorm:"many2many:post_categories;"`
 	PostApproval []PostApproval `gorm:"many2many:post_approval;"`
 	Comments     []Comment      `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	Media        []PostMedia    `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	Steps        []PostStep     `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	Materials    []PostMaterial `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
 }
 
 type PostApproval struct {
@@ -40,14 +51,37 @@ type PostApproval struct {
 
 // ส่ง input ของ Post
 type CreatePostRequest struct {
-	Title             string `json:"title"`
-	Content           string `json:"content"`
-	YouTubeLink       string `json:"youtube_link"`
-	RecommendAgeRange string `json:"RecommendAgeRange"`
-	Categories        []uint `json:"Categories"`
+	Title             string `json:"title" validate:"required,max=150"`
+	Content           string `json:"content" validate:"required"`
+	YouTubeLink       string `json:"youtube_link" validate:"omitempty,url,max=255"`
+	RecommendAgeRange string `json:"RecommendAgeRange" validate:"omitempty,agerange,max=50"`
+	Categories        []uint `json:"Categories" validate:"min=1"`
+
+	// Optional structured tutorial body
+	Difficulty string                  `json:"difficulty" validate:"omitempty,oneof=beginner intermediate advanced"`
+	Steps      []CreateStepRequest     `json:"steps" validate:"max=50,dive"`
+	Materials  []CreateMaterialRequest `json:"materials" validate:"max=100,dive"`
 }
 
-func CreatePost(db *gorm.DB, c *fiber.Ctx) error {
+// uploadError answers a failed image upload: 413 when it is too big,
+// 415 when it is not an image we accept, 500 otherwise
+func uploadError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("Picture must be at most %d MB", config.AppConfig.MaxUploadMB),
+		})
+	case errors.Is(err, imaging.ErrUnsupportedType):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Picture must be a JPEG, PNG or GIF image",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to save picture: " + err.Error(),
+	})
+}
+
+func CreatePost(db *gorm.DB, store storage.Storage, c *fiber.Ctx) error {
 	fmt.Println("userID in Locals:", c.Locals("userID"))
 	userID := c.Locals("userID").(uint)
 
@@ -58,19 +92,52 @@ func CreatePost(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Failed to parse post JSON: " + err.Error(),
 		})
 	}
+	if errs := validation.Struct(postData); errs != nil {
+		return validation.Reply(c, errs)
+	}
 
-	// 2. Parse the uploaded file
-	file, err := c.FormFile("picture")
+	// 2. Save the cover picture and any attachments. Without a picture the
+	// first attached image becomes the cover. Until the post is created,
+	// stored files are released again on any error.
+	var saved []string
+	created := false
+	defer func() {
+		if !created {
+			releaseUploads(db, store, saved...)
+		}
+	}()
+
+	media, err := saveAttachments(c, store)
+	saved = append(saved, mediaKeys(media)...)
 	if err != nil {
+		return mediaError(c, err)
+	}
+
+	pictureKey := ""
+	if file, err := c.FormFile("picture"); err == nil {
+		pictureKey, err = storage.SaveImage(store, file, "posts")
+		if err != nil {
+			return uploadError(c, err)
+		}
+		saved = append(saved, pictureKey)
+	} else {
+		for _, m := range media {
+			if m.Kind == MediaImage {
+				pictureKey = m.Key
+				break
+			}
+		}
+	}
+	if pictureKey == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Picture upload failed: " + err.Error(),
+			"error": "A picture or at least one image attachment is required",
 		})
 	}
-	filePath := fmt.Sprintf("./uploads/%s", file.Filename)
-	if err := c.SaveFile(file, filePath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save picture: " + err.Error(),
-		})
+
+	steps, err := buildSteps(c, store, postData.Steps)
+	saved = append(saved, snapshotTutorial(steps, nil).stepKeys()...)
+	if err != nil {
+		return uploadError(c, err)
 	}
 
 	// 3. Find categories
@@ -83,17 +150,25 @@ func CreatePost(db *gorm.DB, c *fiber.Ctx) error {
 		}
 	}
 
-	// 4. Create Post
+	// 4. Create Post, skipping review for trusted authors
+	status := "pending"
+	if isTrustedAuthor(db, categories, userID) {
+		status = "approved"
+	}
 	post := Post{
 		Title:             postData.Title,
 		Content:           postData.Content,
-		Picture:           file.Filename,
+		Picture:           pictureKey,
 		YouTubeLink:       postData.YouTubeLink,
 		RecommendAgeRange: postData.RecommendAgeRange,
-		Status:            "pending",
+		Status:            status,
 		ApprovedUsers:     0,
 		UserID:            userID,
 		Categories:        categories,
+		Media:             media,
+		Difficulty:        postData.Difficulty,
+		Steps:             steps,
+		Materials:         buildMaterials(postData.Materials),
 	}
 
 	if err := db.Create(&post).Error; err != nil {
@@ -101,35 +176,67 @@ func CreatePost(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Failed to create post: " + err.Error(),
 		})
 	}
+	created = true
 
 	// 5. Return full post with relations
 	var fullPost Post
-	if err := db.Preload("User").Preload("Categories").First(&fullPost, post.ID).Error; err != nil {
+	if err := db.Preload("User").Preload("Categories").Preload("Media", byPosition).
+		Preload("Steps", byPosition).Preload("Materials", byPosition).First(&fullPost, post.ID).Error; err != nil {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message": "Post created but failed to load details",
 			"postID":  post.ID,
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fullPost)
+	categoryDTOs := []CategoryDTO{}
+	for _, cat := range fullPost.Categories {
+		categoryDTOs = append(categoryDTOs, CategoryDTO{
+			ID:             cat.ID,
+			CategoriesName: cat.CategoriesName,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(PostDTO{
+		ID:                fullPost.ID,
+		Title:             fullPost.Title,
+		Content:           fullPost.Content,
+		Picture:           storage.ImageURLsFor(fullPost.Picture),
+		YouTubeLink:       fullPost.YouTubeLink,
+		RecommendAgeRange: fullPost.RecommendAgeRange,
+		Difficulty:        fullPost.Difficulty,
+		Status:            fullPost.Status,
+		Categories:        categoryDTOs,
+		User:              toUserDTO(fullPost.User),
+		CreatedAt:         fullPost.CreatedAt,
+		Media:             toPostMediaDTOs(fullPost.Media),
+		Steps:             toPostStepDTOs(fullPost.Steps),
+		Materials:         toPostMaterialDTOs(fullPost.Materials),
+	})
 }
 
 type PostDTO struct {
-	ID                uint          `json:"id"`
-	Title             string        `json:"title"`
-	Content           string        `json:"content"`
-	Picture           string        `json:"picture"`
-	YouTubeLink       string        `json:"youtube_link"`
-	RecommendAgeRange string        `json:"recommend_age_range"`
-	Status            string        `json:"status"`
-	Categories        []CategoryDTO `json:"categories"`
-	User              UserDTO       `json:"user"`
-	CreatedAt         time.Time     `json:"created_at"`
-	HasLiked          bool          `json:"has_liked"`
-	HasBookmarked     bool          `json:"has_bookmarked"`
-	Comments          []CommentDTO  `json:"comments"`
-	Like              int           `json:"like"`
-	CurrentApprovals  int           `json:"current_approvals"`
+	ID                uint                `json:"id"`
+	Title             string              `json:"title"`
+	Content           string              `json:"content"`
+	Picture           *storage.ImageURLs  `json:"picture"`
+	YouTubeLink       string              `json:"youtube_link"`
+	RecommendAgeRange string              `json:"recommend_age_range"`
+	Status            string              `json:"status"`
+	Categories        []CategoryDTO       `json:"categories"`
+	User              UserDTO             `json:"user"`
+	CreatedAt         time.Time           `json:"created_at"`
+	HasLiked          bool                `json:"has_liked"`
+	HasBookmarked     bool                `json:"has_bookmarked"`
+	Comments          []CommentDTO        `json:"comments"`
+	Like              int                 `json:"like"`
+	CurrentApprovals  int                 `json:"current_approvals"`
+	Reviews           []ReviewDTO         `json:"reviews,omitempty"`
+	PendingRevisionID *uint               `json:"pending_revision_id,omitempty"`
+	Media             []PostMediaDTO      `json:"media,omitempty"`
+	Difficulty        string              `json:"difficulty,omitempty"`
+	Steps             []PostStepDTO       `json:"steps,omitempty"`
+	Materials         []PostMaterialDTO   `json:"materials,omitempty"`
+	Highlight         *SearchHighlightDTO `json:"highlight,omitempty"`
 }
 
 type CategoryDTO struct {
@@ -137,9 +244,46 @@ type CategoryDTO struct {
 	CategoriesName string `json:"categories_name"`
 }
 
+// UserDTO is the public view of a user, safe to show to anyone
 type UserDTO struct {
-	Username string `json:"username"`
-	Picture  string `json:"picture"`
+	ID       uint               `json:"id"`
+	Username string             `json:"username"`
+	Picture  *storage.ImageURLs `json:"picture"`
+}
+
+func toUserDTO(user User) UserDTO {
+	return UserDTO{
+		ID:       user.ID,
+		Username: user.Username,
+		Picture:  storage.ImageURLsFor(user.Picture),
+	}
+}
+
+// toPostSummaryDTO maps a post for list views, without comments or
+// reviews. User and Categories must be preloaded.
+func toPostSummaryDTO(post Post) PostDTO {
+	categories := []CategoryDTO{}
+	for _, cat := range post.Categories {
+		categories = append(categories, CategoryDTO{
+			ID:             cat.ID,
+			CategoriesName: cat.CategoriesName,
+		})
+	}
+
+	return PostDTO{
+		ID:                post.ID,
+		Title:             post.Title,
+		Content:           post.Content,
+		Picture:           storage.ImageURLsFor(post.Picture),
+		YouTubeLink:       post.YouTubeLink,
+		RecommendAgeRange: post.RecommendAgeRange,
+		Difficulty:        post.Difficulty,
+		Status:            post.Status,
+		Categories:        categories,
+		User:              toUserDTO(post.User),
+		CreatedAt:         post.CreatedAt,
+		Like:              post.Like,
+	}
 }
 
 func GetAllPosts(db *gorm.DB) fiber.Handler {
@@ -187,10 +331,7 @@ func GetAllPosts(db *gorm.DB) fiber.Handler {
 					Content:   comment.CommentContent,
 					ParentID:  comment.ParentID,
 					CreatedAt: comment.CreatedAt,
-					User: UserDTO{
-						Username: comment.User.Username,
-						Picture:  comment.User.Picture,
-					},
+					User:      toUserDTO(comment.User),
 				})
 			}
 
@@ -201,19 +342,17 @@ func GetAllPosts(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt:        post.CreatedAt,
-				Like:             post.Like,
-				CurrentApprovals: int(approvalCount),
-				Comments:         comments,
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
+				Like:              post.Like,
+				CurrentApprovals:  int(approvalCount),
+				Comments:          comments,
 			}
 			postDTOs = append(postDTOs, postDTO)
 		}
@@ -250,17 +389,15 @@ func GetPostByID(db *gorm.DB) fiber.Handler {
 			ID:                post.ID,
 			Title:             post.Title,
 			Content:           post.Content,
-			Picture:           post.Picture,
+			Picture:           storage.ImageURLsFor(post.Picture),
 			YouTubeLink:       post.YouTubeLink,
 			RecommendAgeRange: post.RecommendAgeRange,
+			Difficulty:        post.Difficulty,
 			Status:            post.Status,
 			Categories:        categories,
-			User: UserDTO{
-				Username: post.User.Username,
-				Picture:  post.User.Picture,
-			},
-			CreatedAt:        post.CreatedAt,
-			CurrentApprovals: int(approvalCount),
+			User:              toUserDTO(post.User),
+			CreatedAt:         post.CreatedAt,
+			CurrentApprovals:  int(approvalCount),
 		}
 
 		return c.JSON(postDTO)
@@ -307,6 +444,7 @@ func DeletePost(db *gorm.DB) fiber.Handler {
 func SearchPosts(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		query := c.Query("q", "")
+		sort := c.Query("sort") // 'hot', 'trending' or newest
 		page, _ := strconv.Atoi(c.Query("page", "1"))
 		limit, _ := strconv.Atoi(c.Query("limit", "10"))
 		if page < 1 {
@@ -319,24 +457,54 @@ func SearchPosts(db *gorm.DB) fiber.Handler {
 
 		var posts []Post
 
-		if err := db.Preload("User").
+		// Quoted phrases and trailing * prefixes are supported; Thai
+		// queries use substring matching
+		terms := parseSearchQuery(query)
+		search := db.Preload("User").
 			Preload("Categories").
-			Joins("LEFT JOIN post_categories pc ON pc.post_id = posts.id").
-			Joins("LEFT JOIN categories c ON c.id = pc.category_id").
-			Where("(posts.title ILIKE ? OR c.categories_name ILIKE ?) AND posts.status = ?", "%"+query+"%", "%"+query+"%", "approved").
-			Distinct("posts.*").
+			Where("posts.status = ?", "approved")
+		relevance := clause.OrderBy{}
+		tsquery := ""
+		if len(terms) > 0 {
+			search, relevance, tsquery = filterBySearch(db, search, query, terms)
+		}
+		if scored, ok := orderByScore(search, sort); ok {
+			search = scored
+		} else if relevance.Expression != nil {
+			search = search.Order(relevance)
+		} else {
+			search = search.Order("posts.created_at desc")
+		}
+
+		if err := search.
 			Limit(limit).
 			Offset(offset).
-			Order("posts.created_at desc").
 			Find(&posts).Error; err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to search posts: " + err.Error(),
 			})
 		}
 
+		var highlights map[uint]*SearchHighlightDTO
+		if tsquery != "" && len(posts) > 0 {
+			ids := make([]uint, len(posts))
+			for i, post := range posts {
+				ids[i] = post.ID
+			}
+			highlights = searchHighlights(db, ids, tsquery)
+		}
+
 		// Map to DTO
 		var postDTOs []PostDTO
 		for _, post := range posts {
+			highlight := highlights[post.ID]
+			if highlight == nil && len(terms) > 0 {
+				highlight = &SearchHighlightDTO{
+					Title:   substringHighlight(post.Title, terms, 0),
+					Snippet: substringHighlight(post.Content, terms, 200),
+				}
+			}
+
 			var categories []CategoryDTO
 			for _, cat := range post.Categories {
 				categories = append(categories, CategoryDTO{
@@ -352,17 +520,16 @@ func SearchPosts(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt:        post.CreatedAt,
-				CurrentApprovals: int(approvalCount),
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
+				CurrentApprovals:  int(approvalCount),
+				Highlight:         highlight,
 			})
 		}
 
@@ -371,8 +538,9 @@ func SearchPosts(db *gorm.DB) fiber.Handler {
 }
 
 type PostLike struct {
-	PostID uint `gorm:"primaryKey"`
-	UserID uint `gorm:"primaryKey"`
+	PostID    uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey"`
+	CreatedAt time.Time
 
 	Post Post `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
 	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
@@ -457,17 +625,20 @@ func GetMyPosts(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt:        post.CreatedAt,
-				CurrentApprovals: int(approvalCount),
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
+				CurrentApprovals:  int(approvalCount),
+			}
+			postDTO.PendingRevisionID = post.PendingRevisionID
+			// Authors see expert feedback on posts that were not approved
+			if post.Status != "approved" {
+				postDTO.Reviews = getPostReviews(db, post.ID)
 			}
 			postDTOs = append(postDTOs, postDTO)
 		}
@@ -481,7 +652,7 @@ func FilterPosts(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		categoryID := c.Query("category_id")
 		recommendAgeRange := c.Query("recommend_age_range")
-		sort := c.Query("sort") // 'mostlike' or 'recent'
+		sort := c.Query("sort") // 'mostlike', 'hot', 'trending' or 'recent'
 		limit, _ := strconv.Atoi(c.Query("limit", "10"))
 		offset, _ := strconv.Atoi(c.Query("offset", "0"))
 
@@ -505,7 +676,9 @@ func FilterPosts(db *gorm.DB) fiber.Handler {
 		}
 
 		// Modified sorting logic
-		if sort == "mostlike" {
+		if scored, ok := orderByScore(query, sort); ok {
+			query = scored
+		} else if sort == "mostlike" {
 			query = query.Order("posts.like DESC, posts.created_at DESC")
 		} else {
 			query = query.Order("posts.created_at DESC")
@@ -549,10 +722,7 @@ func FilterPosts(db *gorm.DB) fiber.Handler {
 					Content:   comment.CommentContent,
 					ParentID:  comment.ParentID,
 					CreatedAt: comment.CreatedAt,
-					User: UserDTO{
-						Username: comment.User.Username,
-						Picture:  comment.User.Picture,
-					},
+					User:      toUserDTO(comment.User),
 				})
 			}
 
@@ -563,19 +733,17 @@ func FilterPosts(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt:        post.CreatedAt,
-				Like:             post.Like,
-				CurrentApprovals: int(approvalCount),
-				Comments:         comments,
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
+				Like:              post.Like,
+				CurrentApprovals:  int(approvalCount),
+				Comments:          comments,
 			}
 			postDTOs = append(postDTOs, postDTO)
 		}
@@ -599,6 +767,11 @@ func ApprovePost(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
 		}
 
+		// Rejected, removed or already approved posts take no more approvals
+		if post.Status != "pending" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only pending posts can be approved"})
+		}
+
 		// Check if user is trying to approve their own post
 		if post.UserID == userID {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot approve your own post"})
@@ -628,6 +801,10 @@ func ApprovePost(db *gorm.DB) fiber.Handler {
 		if err := db.Where("post_id = ? AND user_id = ?", post.ID, userID).First(&existingApproval).Error; err == nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You have already approved this post"})
 		}
+		var existingReview PostReview
+		if err := db.Where("post_id = ? AND user_id = ?", post.ID, userID).First(&existingReview).Error; err == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You have already reviewed this post"})
+		}
 
 		// Add approval
 		approval := PostApproval{
@@ -639,14 +816,16 @@ func ApprovePost(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to approve post"})
 		}
 
-		// Count total unique expert approvals for this post
-		var approvalCount int64
-		db.Model(&PostApproval{}).Where("post_id = ?", post.ID).Count(&approvalCount)
+		// Collect unique expert approvals for this post
+		var approverIDs []uint
+		db.Model(&PostApproval{}).Where("post_id = ?", post.ID).Pluck("user_id", &approverIDs)
+		approvalCount := len(approverIDs)
 
 		// Update post's Total_Approved_Users
-		post.ApprovedUsers = int(approvalCount)
+		post.ApprovedUsers = approvalCount
 
-		if approvalCount >= 3 && post.Status != "approved" {
+		approved, policy := EvaluateApproval(db, post.Categories, approverIDs)
+		if approved {
 			post.Status = "approved"
 		}
 
@@ -658,6 +837,7 @@ func ApprovePost(db *gorm.DB) fiber.Handler {
 		return c.JSON(fiber.Map{
 			"message":              "Post approved",
 			"current_approvals":    approvalCount,
+			"required_approvals":   policy.RequiredApprovals,
 			"status":               post.Status,
 			"total_approved_users": post.ApprovedUsers,
 		})
@@ -687,17 +867,15 @@ func GetApprovedPosts(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt:        post.CreatedAt,
-				CurrentApprovals: int(approvalCount),
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
+				CurrentApprovals:  int(approvalCount),
 			}
 			postDTOs = append(postDTOs, postDTO)
 		}
@@ -718,6 +896,11 @@ type RequestPost struct {
 	User              User                  `gorm:"foreignKey:UserID;references:ID"`
 	Categories        []Category            `gorm:"many2many:request_post_categories;"`
 	Approvals         []RequestPostApproval `gorm:"many2many:request_post_approval;"`
+
+	// Set once an expert links a published post as the answer
+	AnswerPostID  *uint      `gorm:"default:null"`
+	FulfilledByID *uint      `gorm:"default:null"`
+	FulfilledAt   *time.Time `gorm:"default:null"`
 }
 
 type RequestPostApproval struct {
@@ -730,13 +913,13 @@ type RequestPostApproval struct {
 }
 
 type CreateRequestPostRequest struct {
-	Title             string `json:"title"`
-	Content           string `json:"content"`
-	RecommendAgeRange string `json:"RecommendAgeRange"`
-	Categories        []uint `json:"Categories"`
+	Title             string `json:"title" validate:"required,max=150"`
+	Content           string `json:"content" validate:"required"`
+	RecommendAgeRange string `json:"RecommendAgeRange" validate:"omitempty,agerange,max=50"`
+	Categories        []uint `json:"Categories" validate:"min=1"`
 }
 
-func CreateRequestPost(db *gorm.DB, c *fiber.Ctx) error {
+func CreateRequestPost(db *gorm.DB, store storage.Storage, c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uint)
 
 	postData := new(CreateRequestPostRequest)
@@ -745,19 +928,23 @@ func CreateRequestPost(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Failed to parse post JSON: " + err.Error(),
 		})
 	}
+	if errs := validation.Struct(postData); errs != nil {
+		return validation.Reply(c, errs)
+	}
 
 	file, err := c.FormFile("picture")
-	pictureFilename := ""
+	pictureKey := ""
 	if err == nil && file != nil {
-		filePath := fmt.Sprintf("./uploads/%s", file.Filename)
-		if err := c.SaveFile(file, filePath); err == nil {
-			pictureFilename = file.Filename
+		pictureKey, err = storage.SaveImage(store, file, "requests")
+		if err != nil {
+			return uploadError(c, err)
 		}
 	}
 
 	var categories []Category
 	if len(postData.Categories) > 0 {
 		if err := db.Where("id IN ?", postData.Categories).Find(&categories).Error; err != nil {
+			releaseUploads(db, store, pictureKey)
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Some categories not found: " + err.Error(),
 			})
@@ -767,7 +954,7 @@ func CreateRequestPost(db *gorm.DB, c *fiber.Ctx) error {
 	requestPost := RequestPost{
 		Title:             postData.Title,
 		Content:           postData.Content,
-		Picture:           pictureFilename,
+		Picture:           pictureKey,
 		RecommendAgeRange: postData.RecommendAgeRange,
 		Status:            "pending",
 		UserID:            userID,
@@ -775,12 +962,14 @@ func CreateRequestPost(db *gorm.DB, c *fiber.Ctx) error {
 	}
 
 	if err := db.Create(&requestPost).Error; err != nil {
+		releaseUploads(db, store, pictureKey)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create request post: " + err.Error(),
 		})
 	}
+	db.Preload("User").Preload("Categories").First(&requestPost, requestPost.ID)
 
-	return c.Status(fiber.StatusCreated).JSON(requestPost)
+	return c.Status(fiber.StatusCreated).JSON(toRequestPostDTO(db, requestPost))
 }
 
 // Approve a request post by an expert user
@@ -793,6 +982,12 @@ func ApproveRequestPost(db *gorm.DB) fiber.Handler {
 		if err := db.Preload("Categories").First(&requestPost, requestPostID).Error; err != nil {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Request post not found"})
 		}
+		if requestPost.UserID == userID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot approve your own request post"})
+		}
+		if requestPost.Status == "fulfilled" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Request post is already fulfilled"})
+		}
 
 		var user User
 		if err := db.Preload("ExpertCategories").First(&user, userID).Error; err != nil {
@@ -826,17 +1021,26 @@ func ApproveRequestPost(db *gorm.DB) fiber.Handler {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to approve request post"})
 		}
 
-		var approvalCount int64
-		db.Model(&RequestPostApproval{}).Where("request_post_id = ?", requestPost.ID).Count(&approvalCount)
+		var approverIDs []uint
+		db.Model(&RequestPostApproval{}).Where("request_post_id = ?", requestPost.ID).Pluck("user_id", &approverIDs)
+		approvalCount := len(approverIDs)
 
-		if approvalCount >= 3 && requestPost.Status != "approved" {
-			requestPost.Status = "approved"
-			if err := db.Save(&requestPost).Error; err != nil {
+		approved, policy := EvaluateApproval(db, requestPost.Categories, approverIDs)
+		if approved && requestPost.Status == "pending" {
+			if err := db.Model(&RequestPost{}).
+				Where("id = ? AND status = ?", requestPost.ID, "pending").
+				Update("status", "approved").Error; err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update request post status"})
 			}
+			requestPost.Status = "approved"
 		}
 
-		return c.JSON(fiber.Map{"message": "Request post approved", "current_approvals": approvalCount, "status": requestPost.Status})
+		return c.JSON(fiber.Map{
+			"message":            "Request post approved",
+			"current_approvals":  approvalCount,
+			"required_approvals": policy.RequiredApprovals,
+			"status":             requestPost.Status,
+		})
 	}
 }
 
@@ -859,11 +1063,12 @@ func GetPendingPostsForExpert(db *gorm.DB) fiber.Handler {
 		}
 
 		// Find posts with status 'pending' and at least one matching category
-		// Exclude posts created by the current user
+		// Exclude posts created by the current user or already given feedback by them
 		var posts []Post
 		err := db.Preload("User").Preload("Categories").
 			Joins("JOIN post_categories pc ON pc.post_id = posts.id").
 			Where("posts.status = ? AND pc.category_id IN ? AND posts.user_id != ?", "pending", expertCategoryIDs, userID).
+			Where("posts.id NOT IN (SELECT post_id FROM post_reviews WHERE user_id = ? AND deleted_at IS NULL)", userID).
 			Group("posts.id").
 			Order("posts.created_at desc").
 			Find(&posts).Error
@@ -887,17 +1092,15 @@ func GetPendingPostsForExpert(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt:        post.CreatedAt,
-				CurrentApprovals: int(approvalCount),
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
+				CurrentApprovals:  int(approvalCount),
 			}
 			postDTOs = append(postDTOs, postDTO)
 		}
@@ -905,73 +1108,15 @@ func GetPendingPostsForExpert(db *gorm.DB) fiber.Handler {
 	}
 }
 
-// Achieve a post: increment user's TotalAchievement score for each category of the post
-func AchievePost(db *gorm.DB) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		userID := c.Locals("userID").(uint)
-		postID := c.Params("id")
-
-		// Find the post and its categories
-		var post Post
-		if err := db.Preload("Categories").First(&post, postID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
-		}
-
-		for _, cat := range post.Categories {
-			var achievement TotalAchievement
-			// Use raw SQL to ensure we're using the correct column name
-			err := db.Raw("SELECT * FROM total_achievements WHERE user_id = ? AND \"Categories_id\" = ?", userID, cat.ID).Scan(&achievement).Error
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check achievement"})
-			}
-
-			if achievement.UserID == 0 {
-				// Not found, create new
-				achievement = TotalAchievement{
-					UserID:     userID,
-					CategoryID: cat.ID,
-					Score:      1,
-				}
-				if err := db.Exec("INSERT INTO total_achievements (user_id, \"Categories_id\", score) VALUES (?, ?, ?)",
-					userID, cat.ID, 1).Error; err != nil {
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create achievement"})
-				}
-			} else {
-				// Found, increment score
-				if err := db.Exec("UPDATE total_achievements SET score = score + 1 WHERE user_id = ? AND \"Categories_id\" = ?",
-					userID, cat.ID).Error; err != nil {
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update achievement"})
-				}
-			}
-		}
-
-		return c.JSON(fiber.Map{"message": "Achievement updated for post categories"})
-	}
-}
-
 // Get current user's achievement scores for each category
 func GetMyAchievements(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
-		var achievements []TotalAchievement
-		if err := db.Preload("Category").Where("user_id = ?", userID).Find(&achievements).Error; err != nil {
+		scores, err := categoryScores(db, userID)
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch achievements"})
 		}
-
-		type AchievementDTO struct {
-			CategoryID   uint   `json:"category_id"`
-			CategoryName string `json:"category_name"`
-			Score        int    `json:"score"`
-		}
-		var result []AchievementDTO
-		for _, a := range achievements {
-			result = append(result, AchievementDTO{
-				CategoryID:   a.CategoryID,
-				CategoryName: a.Category.CategoriesName,
-				Score:        a.Score,
-			})
-		}
-		return c.JSON(result)
+		return c.JSON(scores)
 	}
 }
 
@@ -981,13 +1126,15 @@ func GetMyAchievedPosts(db *gorm.DB) fiber.Handler {
 		userID := c.Locals("userID").(uint)
 
 		// Get all category IDs where user has achievement
-		var achievements []TotalAchievement
-		if err := db.Where("user_id = ? AND score > 0", userID).Find(&achievements).Error; err != nil {
+		scores, err := categoryScores(db, userID)
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch achievements"})
 		}
 		var achievedCategoryIDs []uint
-		for _, a := range achievements {
-			achievedCategoryIDs = append(achievedCategoryIDs, a.CategoryID)
+		for _, s := range scores {
+			if s.Score > 0 {
+				achievedCategoryIDs = append(achievedCategoryIDs, s.CategoryID)
+			}
 		}
 		if len(achievedCategoryIDs) == 0 {
 			return c.JSON([]PostDTO{})
@@ -995,7 +1142,7 @@ func GetMyAchievedPosts(db *gorm.DB) fiber.Handler {
 
 		// Find posts that have at least one category in achievedCategoryIDs
 		var posts []Post
-		err := db.Preload("User").Preload("Categories").
+		err = db.Preload("User").Preload("Categories").
 			Joins("JOIN post_categories pc ON pc.post_id = posts.id").
 			Where("pc.category_id IN ?", achievedCategoryIDs).
 			Group("posts.id").
@@ -1019,16 +1166,14 @@ func GetMyAchievedPosts(db *gorm.DB) fiber.Handler {
 				ID:                post.ID,
 				Title:             post.Title,
 				Content:           post.Content,
-				Picture:           post.Picture,
+				Picture:           storage.ImageURLsFor(post.Picture),
 				YouTubeLink:       post.YouTubeLink,
 				RecommendAgeRange: post.RecommendAgeRange,
+				Difficulty:        post.Difficulty,
 				Status:            post.Status,
 				Categories:        categories,
-				User: UserDTO{
-					Username: post.User.Username,
-					Picture:  post.User.Picture,
-				},
-				CreatedAt: post.CreatedAt,
+				User:              toUserDTO(post.User),
+				CreatedAt:         post.CreatedAt,
 			}
 			postDTOs = append(postDTOs, postDTO)
 		}
@@ -1088,16 +1233,14 @@ func RecommendPostsByAge(db *gorm.DB) fiber.Handler {
 						ID:                post.ID,
 						Title:             post.Title,
 						Content:           post.Content,
-						Picture:           post.Picture,
+						Picture:           storage.ImageURLsFor(post.Picture),
 						YouTubeLink:       post.YouTubeLink,
 						RecommendAgeRange: post.RecommendAgeRange,
+						Difficulty:        post.Difficulty,
 						Status:            post.Status,
 						Categories:        categories,
-						User: UserDTO{
-							Username: post.User.Username,
-							Picture:  post.User.Picture,
-						},
-						CreatedAt: post.CreatedAt,
+						User:              toUserDTO(post.User),
+						CreatedAt:         post.CreatedAt,
 					}
 					recommended = append(recommended, postDTO)
 				}
@@ -1128,6 +1271,9 @@ func GetPostDetails(db *gorm.DB) fiber.Handler {
 			Preload("Comments", func(db *gorm.DB) *gorm.DB {
 				return db.Preload("User").Order("created_at DESC")
 			}).
+			Preload("Media", byPosition).
+			Preload("Steps", byPosition).
+			Preload("Materials", byPosition).
 			First(&post, postID).Error; err != nil {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Post not found",
@@ -1139,20 +1285,21 @@ func GetPostDetails(db *gorm.DB) fiber.Handler {
 			ID:                post.ID,
 			Title:             post.Title,
 			Content:           post.Content,
-			Picture:           post.Picture,
+			Picture:           storage.ImageURLsFor(post.Picture),
 			YouTubeLink:       post.YouTubeLink,
 			RecommendAgeRange: post.RecommendAgeRange,
+			Difficulty:        post.Difficulty,
 			Status:            post.Status,
 			Categories:        []CategoryDTO{},
-			User: UserDTO{
-				Username: post.User.Username,
-				Picture:  post.User.Picture,
-			},
-			CreatedAt:     post.CreatedAt,
-			HasLiked:      false,
-			HasBookmarked: false,
-			Like:          post.Like,
-			Comments:      []CommentDTO{},
+			User:              toUserDTO(post.User),
+			CreatedAt:         post.CreatedAt,
+			HasLiked:          false,
+			HasBookmarked:     false,
+			Like:              post.Like,
+			Comments:          []CommentDTO{},
+			Media:             toPostMediaDTOs(post.Media),
+			Steps:             toPostStepDTOs(post.Steps),
+			Materials:         toPostMaterialDTOs(post.Materials),
 		}
 
 		// Only check likes and bookmarks if user is logged in
@@ -1181,10 +1328,7 @@ func GetPostDetails(db *gorm.DB) fiber.Handler {
 				Content:   comment.CommentContent,
 				ParentID:  comment.ParentID,
 				CreatedAt: comment.CreatedAt,
-				User: UserDTO{
-					Username: comment.User.Username,
-					Picture:  comment.User.Picture,
-				},
+				User:      toUserDTO(comment.User),
 			})
 		}
 
@@ -1204,7 +1348,7 @@ func AddComment(db *gorm.DB) fiber.Handler {
 		}
 
 		var input struct {
-			Content  string `json:"content"`
+			Content  string `json:"content" validate:"required,max=2000"`
 			ParentID *uint  `json:"parent_id"`
 		}
 
@@ -1213,6 +1357,9 @@ func AddComment(db *gorm.DB) fiber.Handler {
 				"error": "Invalid input",
 			})
 		}
+		if errs := validation.Struct(&input); errs != nil {
+			return validation.Reply(c, errs)
+		}
 
 		comment := Comment{
 			CommentContent: input.Content,
@@ -1239,10 +1386,7 @@ func AddComment(db *gorm.DB) fiber.Handler {
 			Content:   comment.CommentContent,
 			ParentID:  comment.ParentID,
 			CreatedAt: comment.CreatedAt,
-			User: UserDTO{
-				Username: comment.User.Username,
-				Picture:  comment.User.Picture,
-			},
+			User:      toUserDTO(comment.User),
 		})
 	}
 }
@@ -1266,65 +1410,46 @@ func ToggleBookmark(db *gorm.DB) fiber.Handler {
 			})
 		}
 
-		var bookmark Bookmark
-		err = db.Where("post_id = ? AND user_id = ?", postID, userID).First(&bookmark).Error
-
-		if err == nil {
-			// Bookmark exists, remove it
-			if err := db.Delete(&bookmark).Error; err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to remove bookmark",
-				})
+		// The bookmark and the points it earns change together
+		bookmarked := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var bookmark Bookmark
+			if err := tx.Where("post_id = ? AND user_id = ?", postID, userID).First(&bookmark).Error; err == nil {
+				// Bookmark exists, remove it and take back the points it earned.
+				// A concurrent toggle may have removed it already.
+				result := tx.Delete(&bookmark)
+				if result.Error != nil || result.RowsAffected == 0 {
+					return result.Error
+				}
+				return recordAchievement(tx, userID, post.Categories, &post.ID, SourceUnbookmarked, -1)
 			}
 
-			// Decrement achievement scores for each category
-			for _, cat := range post.Categories {
-				var achievement TotalAchievement
-				if err := db.Where("user_id = ? AND category_id = ?", userID, cat.ID).First(&achievement).Error; err == nil {
-					if achievement.Score > 0 {
-						achievement.Score--
-						db.Save(&achievement)
-					}
-				}
+			// Create new bookmark and award a point in each of the post's categories.
+			// The unique index turns a concurrent duplicate into a no-op, and
+			// that one earns nothing.
+			bookmarked = true
+			bookmark = Bookmark{
+				UserID: userID,
+				PostID: uint(postID),
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bookmark)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
 			}
+			return recordAchievement(tx, userID, post.Categories, &post.ID, SourceBookmarked, 1)
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update bookmark",
+			})
+		}
 
+		if !bookmarked {
 			return c.JSON(fiber.Map{
 				"message":    "Bookmark removed",
 				"bookmarked": false,
 			})
 		}
-
-		// Create new bookmark
-		bookmark = Bookmark{
-			UserID: userID,
-			PostID: uint(postID),
-		}
-
-		if err := db.Create(&bookmark).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to create bookmark",
-			})
-		}
-
-		// Increment achievement scores for each category
-		for _, cat := range post.Categories {
-			var achievement TotalAchievement
-			err := db.Where("user_id = ? AND category_id = ?", userID, cat.ID).First(&achievement).Error
-			if err != nil {
-				// Not found, create new
-				achievement = TotalAchievement{
-					UserID:     userID,
-					CategoryID: cat.ID,
-					Score:      1,
-				}
-				db.Create(&achievement)
-			} else {
-				// Found, increment score
-				achievement.Score++
-				db.Save(&achievement)
-			}
-		}
-
 		return c.JSON(fiber.Map{
 			"message":    "Post bookmarked",
 			"bookmarked": true,
@@ -1332,11 +1457,23 @@ func ToggleBookmark(db *gorm.DB) fiber.Handler {
 	}
 }
 
-// Bookmark model
+// Bookmark model. A user holds at most one live bookmark per post.
 type Bookmark struct {
 	gorm.Model
-	UserID uint `gorm:"not null"`
-	PostID uint `gorm:"not null"`
+	UserID uint `gorm:"not null;uniqueIndex:idx_bookmarks_user_post,where:deleted_at IS NULL"`
+	PostID uint `gorm:"not null;uniqueIndex:idx_bookmarks_user_post"`
 	User   User `gorm:"foreignKey:UserID;references:ID"`
 	Post   Post `gorm:"foreignKey:PostID;references:ID"`
 }
+
+// dedupeBookmarks soft-deletes all but the oldest live bookmark of each
+// user and post, left behind by toggles that raced before the unique index
+func dedupeBookmarks(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Bookmark{}) {
+		return nil
+	}
+	return db.Exec(`UPDATE bookmarks SET deleted_at = NOW()
+		WHERE deleted_at IS NULL AND id NOT IN (
+			SELECT MIN(id) FROM bookmarks WHERE deleted_at IS NULL GROUP BY user_id, post_id
+		)`).Error
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PublicProfileDTO is what anyone can see about a user. Age and sex are
+// only included when the user chose to show them.
+type PublicProfileDTO struct {
+	UserDTO
+	Role             string          `json:"role"`
+	Age              *int            `json:"age,omitempty"`
+	Sex              string          `json:"sex,omitempty"`
+	ExpertCategories []CategoryDTO   `json:"expert_categories"`
+	Scores           []CategoryScore `json:"scores"`
+	Badges           []BadgeDTO      `json:"badges"`
+	JoinedAt         time.Time       `json:"joined_at"`
+	FollowersCount   int64           `json:"followers_count"`
+	FollowingCount   int64           `json:"following_count"`
+	Posts            []PostDTO       `json:"posts"`
+	TotalPosts       int64           `json:"total_posts"`
+	Page             int             `json:"page"`
+}
+
+// Show a user's public profile with their published posts
+func GetPublicProfile(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "10"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 50 {
+			limit = 10
+		}
+
+		var user User
+		if err := db.Preload("ExpertCategories").
+			Where("username = ? AND suspended = ?", c.Params("username"), false).
+			First(&user).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		profile := PublicProfileDTO{
+			UserDTO:          toUserDTO(user),
+			Role:             user.Role,
+			ExpertCategories: []CategoryDTO{},
+			JoinedAt:         user.CreatedAt,
+			Posts:            []PostDTO{},
+			Page:             page,
+		}
+		profile.FollowersCount, profile.FollowingCount = followCounts(db, user.ID)
+		if user.ShowAge && user.Age > 0 {
+			age := user.Age
+			profile.Age = &age
+		}
+		if user.ShowSex {
+			profile.Sex = user.Sex
+		}
+		for _, cat := range user.ExpertCategories {
+			profile.ExpertCategories = append(profile.ExpertCategories, CategoryDTO{
+				ID:             cat.ID,
+				CategoriesName: cat.CategoriesName,
+			})
+		}
+
+		var err error
+		if profile.Scores, err = categoryScores(db, user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch achievements"})
+		}
+		if profile.Badges, err = userBadges(db, user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch badges"})
+		}
+
+		db.Model(&Post{}).Where("user_id = ? AND status = ?", user.ID, "approved").Count(&profile.TotalPosts)
+
+		var posts []Post
+		if err := db.Preload("User").Preload("Categories").
+			Where("user_id = ? AND status = ?", user.ID, "approved").
+			Order("created_at desc").
+			Limit(limit).
+			Offset((page - 1) * limit).
+			Find(&posts).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch posts"})
+		}
+		for _, post := range posts {
+			profile.Posts = append(profile.Posts, toPostSummaryDTO(post))
+		}
+
+		return c.JSON(profile)
+	}
+}
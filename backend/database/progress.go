@@ -0,0 +1,304 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dadadun/lifskill/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostProgress is a learner working through a post. FinishedAt is set
+// once, when the post is completed and category score is awarded.
+type PostProgress struct {
+	UserID     uint      `gorm:"primaryKey"`
+	PostID     uint      `gorm:"primaryKey;index"`
+	StartedAt  time.Time `gorm:"not null"`
+	UpdatedAt  time.Time
+	FinishedAt *time.Time `gorm:"default:null"`
+
+	Post Post `gorm:"foreignKey:PostID;references:ID"`
+}
+
+// StepCompletion records that a learner ticked off one step of a post
+type StepCompletion struct {
+	UserID      uint      `gorm:"primaryKey"`
+	StepID      uint      `gorm:"primaryKey"`
+	PostID      uint      `gorm:"not null;index"`
+	CompletedAt time.Time `gorm:"not null"`
+}
+
+type ProgressDTO struct {
+	PostID         uint               `json:"post_id"`
+	Title          string             `json:"title"`
+	Picture        *storage.ImageURLs `json:"picture"`
+	StartedAt      time.Time          `json:"started_at"`
+	FinishedAt     *time.Time         `json:"finished_at"`
+	CompletedSteps []uint             `json:"completed_steps"`
+	TotalSteps     int                `json:"total_steps"`
+}
+
+// startProgress records that the user started the post, keeping the
+// original start time when they already had
+func startProgress(db *gorm.DB, userID, postID uint) (PostProgress, error) {
+	now := time.Now()
+	progress := PostProgress{UserID: userID, PostID: postID, StartedAt: now, UpdatedAt: now}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&progress).Error; err != nil {
+		return progress, err
+	}
+	err := db.Where("user_id = ? AND post_id = ?", userID, postID).First(&progress).Error
+	return progress, err
+}
+
+func toProgressDTO(db *gorm.DB, progress PostProgress) ProgressDTO {
+	return toProgressDTOs(db, []PostProgress{progress})[0]
+}
+
+// toProgressDTOs maps progress records of one user, loading completed
+// steps and step counts with one query each
+func toProgressDTOs(db *gorm.DB, progresses []PostProgress) []ProgressDTO {
+	result := []ProgressDTO{}
+	if len(progresses) == 0 {
+		return result
+	}
+	postIDs := make([]uint, 0, len(progresses))
+	for _, p := range progresses {
+		postIDs = append(postIDs, p.PostID)
+	}
+
+	var completions []StepCompletion
+	db.Select("post_id", "step_id").
+		Where("user_id = ? AND post_id IN ?", progresses[0].UserID, postIDs).
+		Order("step_id").
+		Find(&completions)
+	completed := map[uint][]uint{}
+	for _, sc := range completions {
+		completed[sc.PostID] = append(completed[sc.PostID], sc.StepID)
+	}
+
+	var counts []struct {
+		PostID uint
+		Total  int
+	}
+	db.Model(&PostStep{}).
+		Select("post_id, COUNT(*) AS total").
+		Where("post_id IN ?", postIDs).
+		Group("post_id").
+		Scan(&counts)
+	totals := map[uint]int{}
+	for _, c := range counts {
+		totals[c.PostID] = c.Total
+	}
+
+	for _, p := range progresses {
+		steps := completed[p.PostID]
+		if steps == nil {
+			steps = []uint{}
+		}
+		result = append(result, ProgressDTO{
+			PostID:         p.PostID,
+			Title:          p.Post.Title,
+			Picture:        storage.ImageURLsFor(p.Post.Picture),
+			StartedAt:      p.StartedAt,
+			FinishedAt:     p.FinishedAt,
+			CompletedSteps: steps,
+			TotalSteps:     totals[p.PostID],
+		})
+	}
+	return result
+}
+
+// findLearnablePost loads a published post for progress tracking
+func findLearnablePost(db *gorm.DB, c *fiber.Ctx) (*Post, error) {
+	var post Post
+	if err := db.Preload("Categories").First(&post, c.Params("id")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+	if post.Status != "approved" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only published posts can be learned"})
+	}
+	return &post, nil
+}
+
+// Start learning a post (safe to call again)
+func StartPostProgress(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		post, err := findLearnablePost(db, c)
+		if post == nil {
+			return err
+		}
+
+		progress, err := startProgress(db, userID, post.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start post"})
+		}
+		progress.Post = *post
+		return c.JSON(toProgressDTO(db, progress))
+	}
+}
+
+// Get the current user's progress on a post
+func GetPostProgress(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var progress PostProgress
+		if err := db.Preload("Post").
+			Where("user_id = ? AND post_id = ?", userID, c.Params("id")).
+			First(&progress).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "You have not started this post"})
+		}
+		return c.JSON(toProgressDTO(db, progress))
+	}
+}
+
+// Tick or untick one step of a post. Starts the post if needed.
+func SetStepCompleted(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var input struct {
+			Completed bool `json:"completed"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+
+		post, err := findLearnablePost(db, c)
+		if post == nil {
+			return err
+		}
+
+		var step PostStep
+		if err := db.Where("id = ? AND post_id = ?", c.Params("step_id"), post.ID).First(&step).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Step not found"})
+		}
+
+		progress, err := startProgress(db, userID, post.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start post"})
+		}
+
+		if input.Completed {
+			err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&StepCompletion{
+				UserID:      userID,
+				StepID:      step.ID,
+				PostID:      post.ID,
+				CompletedAt: time.Now(),
+			}).Error
+		} else {
+			err = db.Where("user_id = ? AND step_id = ?", userID, step.ID).Delete(&StepCompletion{}).Error
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update step"})
+		}
+		db.Model(&progress).Update("updated_at", time.Now())
+
+		progress.Post = *post
+		return c.JSON(toProgressDTO(db, progress))
+	}
+}
+
+var errAlreadyCompleted = errors.New("post already completed")
+
+// Complete a post. Category score is awarded only the first time, so
+// completing the same post again changes nothing.
+func AchievePost(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		post, err := findLearnablePost(db, c)
+		if post == nil {
+			return err
+		}
+
+		var progress PostProgress
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if progress, err = startProgress(tx, userID, post.ID); err != nil {
+				return err
+			}
+
+			// Only the request that sets finished_at awards score
+			now := time.Now()
+			result := tx.Model(&PostProgress{}).
+				Where("user_id = ? AND post_id = ? AND finished_at IS NULL", userID, post.ID).
+				Updates(map[string]interface{}{"finished_at": now, "updated_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errAlreadyCompleted
+			}
+			progress.FinishedAt = &now
+
+			return recordAchievement(tx, userID, post.Categories, &post.ID, SourcePostCompleted, 1)
+		})
+		if errors.Is(err, errAlreadyCompleted) {
+			return c.JSON(fiber.Map{
+				"message":           "You have already completed this post",
+				"already_completed": true,
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to complete post"})
+		}
+
+		progress.Post = *post
+		return c.JSON(fiber.Map{
+			"message":           "Achievement updated for post categories",
+			"already_completed": false,
+			"progress":          toProgressDTO(db, progress),
+		})
+	}
+}
+
+// List the current user's posts in progress and completed, most recently
+// active first, a page at a time
+func GetMyProgress(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 50 {
+			limit = 20
+		}
+
+		// Posts deleted since are left out
+		var progresses []PostProgress
+		if err := db.Preload("Post").
+			Joins("JOIN posts ON posts.id = post_progresses.post_id AND posts.deleted_at IS NULL").
+			Where("post_progresses.user_id = ?", userID).
+			Order("post_progresses.updated_at desc").
+			Limit(limit).
+			Offset((page - 1) * limit).
+			Find(&progresses).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch progress"})
+		}
+
+		inProgress := []ProgressDTO{}
+		completed := []ProgressDTO{}
+		for _, dto := range toProgressDTOs(db, progresses) {
+			if dto.FinishedAt != nil {
+				completed = append(completed, dto)
+			} else {
+				inProgress = append(inProgress, dto)
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"in_progress": inProgress,
+			"completed":   completed,
+			"page":        page,
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sort options backed by PostScore
+const (
+	SortHot      = "hot"
+	SortTrending = "trending"
+)
+
+// Engagement weights shared by both scores
+const (
+	weightLike       = 1.0
+	weightComment    = 1.0
+	weightBookmark   = 2.0
+	weightCompletion = 3.0
+)
+
+// PostScore caches ranking scores for approved posts. Hot ranks total
+// engagement against the post's age; trending only counts engagement
+// from the last week, each interaction decaying with a one day half-life.
+type PostScore struct {
+	PostID    uint      `gorm:"primaryKey"`
+	Hot       float64   `gorm:"not null;default:0;index"`
+	Trending  float64   `gorm:"not null;default:0;index"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+const refreshScoresSQL = `
+WITH events AS (
+	SELECT post_id, created_at, @like::float8 AS weight FROM post_likes WHERE created_at >= @since
+	UNION ALL
+	SELECT post_id, created_at, @comment FROM comments WHERE deleted_at IS NULL AND created_at >= @since
+	UNION ALL
+	SELECT post_id, created_at, @bookmark FROM bookmarks WHERE deleted_at IS NULL AND created_at >= @since
+	UNION ALL
+	SELECT post_id, finished_at, @completion FROM post_progresses WHERE finished_at >= @since
+),
+recent AS (
+	SELECT post_id, SUM(weight * exp(-ln(2) * extract(epoch FROM (@now - created_at)) / 86400)) AS score
+	FROM events
+	GROUP BY post_id
+),
+totals AS (
+	SELECT p.id AS post_id,
+		p."like" * @like::float8
+		+ (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) * @comment
+		+ (SELECT COUNT(*) FROM bookmarks b WHERE b.post_id = p.id AND b.deleted_at IS NULL) * @bookmark
+		+ (SELECT COUNT(*) FROM post_progresses pp WHERE pp.post_id = p.id AND pp.finished_at IS NOT NULL) * @completion
+		AS engagement,
+		p.created_at
+	FROM posts p
+	WHERE p.status = 'approved' AND p.deleted_at IS NULL
+)
+INSERT INTO post_scores (post_id, hot, trending, updated_at)
+SELECT t.post_id,
+	t.engagement / power(GREATEST(extract(epoch FROM (@now - t.created_at)) / 3600, 0) + 2, 1.8),
+	COALESCE(r.score, 0),
+	@now
+FROM totals t
+LEFT JOIN recent r ON r.post_id = t.post_id
+ON CONFLICT (post_id) DO UPDATE
+SET hot = EXCLUDED.hot, trending = EXCLUDED.trending, updated_at = EXCLUDED.updated_at`
+
+// RefreshPostScores recomputes the scores of every approved post and
+// drops scores of posts that are no longer listed
+func RefreshPostScores(db *gorm.DB) error {
+	// Postgres keeps microseconds; rows written by this run must compare
+	// equal to now below
+	now := time.Now().Truncate(time.Microsecond)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(refreshScoresSQL, map[string]interface{}{
+			"now":        now,
+			"since":      now.AddDate(0, 0, -7),
+			"like":       weightLike,
+			"comment":    weightComment,
+			"bookmark":   weightBookmark,
+			"completion": weightCompletion,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("updated_at < ?", now).Delete(&PostScore{}).Error
+	})
+}
+
+// StartRankingJob refreshes post scores right away and then every
+// interval, until ctx is done. interval must be positive.
+func StartRankingJob(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go runPeriodically(ctx, db, interval, "post scores", RefreshPostScores)
+}
+
+// runPeriodically calls refresh right away and then every interval until
+// ctx is done, logging failures
+func runPeriodically(ctx context.Context, db *gorm.DB, interval time.Duration, what string, refresh func(*gorm.DB) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := refresh(db.WithContext(ctx)); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh %s: %v", what, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// orderByScore sorts a posts query by a PostScore column. It reports
+// false when sort is not a score-backed option.
+func orderByScore(query *gorm.DB, sort string) (*gorm.DB, bool) {
+	if sort != SortHot && sort != SortTrending {
+		return query, false
+	}
+	return query.Joins("LEFT JOIN post_scores ps ON ps.post_id = posts.id").
+		Order("COALESCE(ps." + sort + ", 0) DESC, posts.created_at DESC"), true
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dadadun/lifskill/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type RequestPostDTO struct {
+	ID                uint               `json:"id"`
+	Title             string             `json:"title"`
+	Content           string             `json:"content"`
+	Picture           *storage.ImageURLs `json:"picture"`
+	RecommendAgeRange string             `json:"recommend_age_range"`
+	Status            string             `json:"status"`
+	Categories        []CategoryDTO      `json:"categories"`
+	User              UserDTO            `json:"user"`
+	CreatedAt         time.Time          `json:"created_at"`
+	CurrentApprovals  int                `json:"current_approvals"`
+	AnswerPostID      *uint              `json:"answer_post_id"`
+	FulfilledAt       *time.Time         `json:"fulfilled_at"`
+}
+
+func toRequestPostDTO(db *gorm.DB, requestPost RequestPost) RequestPostDTO {
+	categories := []CategoryDTO{}
+	for _, cat := range requestPost.Categories {
+		categories = append(categories, CategoryDTO{
+			ID:             cat.ID,
+			CategoriesName: cat.CategoriesName,
+		})
+	}
+
+	var approvalCount int64
+	db.Model(&RequestPostApproval{}).Where("request_post_id = ?", requestPost.ID).Count(&approvalCount)
+
+	return RequestPostDTO{
+		ID:                requestPost.ID,
+		Title:             requestPost.Title,
+		Content:           requestPost.Content,
+		Picture:           storage.ImageURLsFor(requestPost.Picture),
+		RecommendAgeRange: requestPost.RecommendAgeRange,
+		Status:            requestPost.Status,
+		Categories:        categories,
+		User:              toUserDTO(requestPost.User),
+		CreatedAt:         requestPost.CreatedAt,
+		CurrentApprovals:  int(approvalCount),
+		AnswerPostID:      requestPost.AnswerPostID,
+		FulfilledAt:       requestPost.FulfilledAt,
+	}
+}
+
+// List request posts, optionally filtered by status and category
+func GetRequestPosts(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		status := c.Query("status")
+		categoryID := c.Query("category_id")
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "10"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 10
+		}
+		offset := (page - 1) * limit
+
+		query := db.Preload("User").Preload("Categories")
+		if status != "" {
+			query = query.Where("request_posts.status = ?", status)
+		}
+		if categoryID != "" {
+			query = query.Joins("JOIN request_post_categories rpc ON rpc.request_post_id = request_posts.id").
+				Where("rpc.category_id = ?", categoryID)
+		}
+
+		var requestPosts []RequestPost
+		if err := query.Order("request_posts.created_at desc").
+			Limit(limit).
+			Offset(offset).
+			Find(&requestPosts).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch request posts"})
+		}
+
+		result := []RequestPostDTO{}
+		for _, requestPost := range requestPosts {
+			result = append(result, toRequestPostDTO(db, requestPost))
+		}
+		return c.JSON(result)
+	}
+}
+
+// Get a single request post
+func GetRequestPostByID(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var requestPost RequestPost
+		if err := db.Preload("User").Preload("Categories").First(&requestPost, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Request post not found"})
+		}
+		return c.JSON(toRequestPostDTO(db, requestPost))
+	}
+}
+
+// Fulfill a request post by linking an approved post as its answer.
+// Only experts in one of the request's categories may do this.
+func FulfillRequestPost(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var input struct {
+			PostID uint `json:"post_id"`
+		}
+		if err := c.BodyParser(&input); err != nil || input.PostID == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "post_id is required"})
+		}
+
+		var requestPost RequestPost
+		if err := db.Preload("Categories").First(&requestPost, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Request post not found"})
+		}
+		if requestPost.Status == "fulfilled" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Request post is already fulfilled"})
+		}
+		if requestPost.Status != "approved" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only approved request posts can be fulfilled"})
+		}
+
+		var post Post
+		if err := db.First(&post, input.PostID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+		if post.Status != "approved" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only published posts can answer a request"})
+		}
+
+		var user User
+		if err := db.Preload("ExpertCategories").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		isExpert := false
+		for _, requestCat := range requestPost.Categories {
+			for _, expertCat := range user.ExpertCategories {
+				if requestCat.ID == expertCat.ID {
+					isExpert = true
+					break
+				}
+			}
+		}
+		if !isExpert {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not an expert in this request post's category"})
+		}
+
+		// Only one expert can win the update from "approved"
+		now := time.Now()
+		result := db.Model(&RequestPost{}).
+			Where("id = ? AND status = ?", requestPost.ID, "approved").
+			Updates(map[string]interface{}{
+				"status":          "fulfilled",
+				"answer_post_id":  post.ID,
+				"fulfilled_by_id": userID,
+				"fulfilled_at":    now,
+			})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fulfill request post"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Request post is already fulfilled"})
+		}
+		requestPost.Status = "fulfilled"
+
+		notify(db, requestPost.UserID, "request_fulfilled",
+			fmt.Sprintf("Your request \"%s\" has been answered", requestPost.Title), &post.ID)
+
+		return c.JSON(fiber.Map{
+			"message":        "Request post fulfilled",
+			"status":         requestPost.Status,
+			"answer_post_id": post.ID,
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Review decisions
+const (
+	ReviewRejected         = "rejected"
+	ReviewChangesRequested = "changes_requested"
+)
+
+// PostReview stores negative expert feedback on a pending post
+type PostReview struct {
+	gorm.Model
+	PostID   uint   `gorm:"not null;index"`
+	UserID   uint   `gorm:"not null"`
+	Decision string `gorm:"size:20;not null"`
+	Reason   string `gorm:"type:text;not null"`
+
+	Post Post `gorm:"foreignKey:PostID;references:ID"`
+	User User `gorm:"foreignKey:UserID;references:ID"`
+}
+
+type ReviewDTO struct {
+	ID        uint      `json:"id"`
+	Decision  string    `json:"decision"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	Reviewer  UserDTO   `json:"reviewer"`
+}
+
+func getPostReviews(db *gorm.DB, postID uint) []ReviewDTO {
+	var reviews []PostReview
+	db.Preload("User").Where("post_id = ?", postID).Order("created_at desc").Find(&reviews)
+
+	result := []ReviewDTO{}
+	for _, r := range reviews {
+		result = append(result, ReviewDTO{
+			ID:        r.ID,
+			Decision:  r.Decision,
+			Reason:    r.Reason,
+			CreatedAt: r.CreatedAt,
+			Reviewer:  toUserDTO(r.User),
+		})
+	}
+	return result
+}
+
+// Reject a pending post or request changes, with a written reason
+func RejectPost(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		postID := c.Params("id")
+
+		var input struct {
+			Decision string `json:"decision"`
+			Reason   string `json:"reason"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if input.Decision == "" {
+			input.Decision = ReviewRejected
+		}
+		if input.Decision != ReviewRejected && input.Decision != ReviewChangesRequested {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "decision must be rejected or changes_requested"})
+		}
+		input.Reason = strings.TrimSpace(input.Reason)
+		if input.Reason == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A reason is required"})
+		}
+
+		var post Post
+		if err := db.Preload("Categories").First(&post, postID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+		if post.Status != "pending" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only pending posts can be reviewed"})
+		}
+		if post.UserID == userID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot review your own post"})
+		}
+
+		var user User
+		if err := db.Preload("ExpertCategories").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		isExpert := false
+		for _, postCat := range post.Categories {
+			for _, expertCat := range user.ExpertCategories {
+				if postCat.ID == expertCat.ID {
+					isExpert = true
+					break
+				}
+			}
+		}
+		if !isExpert {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not an expert in this post's category"})
+		}
+
+		// An expert gives one verdict per post, either approval or feedback
+		var existingApproval PostApproval
+		if err := db.Where("post_id = ? AND user_id = ?", post.ID, userID).First(&existingApproval).Error; err == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You have already approved this post"})
+		}
+		var existingReview PostReview
+		if err := db.Where("post_id = ? AND user_id = ?", post.ID, userID).First(&existingReview).Error; err == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You have already reviewed this post"})
+		}
+
+		review := PostReview{
+			PostID:   post.ID,
+			UserID:   userID,
+			Decision: input.Decision,
+			Reason:   input.Reason,
+		}
+		if err := db.Create(&review).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+		}
+
+		// Enough rejections reject the post; enough negative reviews of
+		// either kind send it back to the author for changes. "Enough" is
+		// the same count the categories' policy requires for approval.
+		reviewThreshold := int64(approvalPolicyFor(post.Categories).RequiredApprovals)
+		var rejectionCount, reviewCount int64
+		db.Model(&PostReview{}).Where("post_id = ? AND decision = ?", post.ID, ReviewRejected).Count(&rejectionCount)
+		db.Model(&PostReview{}).Where("post_id = ?", post.ID).Count(&reviewCount)
+
+		newStatus := post.Status
+		if rejectionCount >= reviewThreshold {
+			newStatus = ReviewRejected
+		} else if reviewCount >= reviewThreshold {
+			newStatus = ReviewChangesRequested
+		}
+
+		if newStatus != post.Status {
+			if err := db.Model(&post).Update("status", newStatus).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update post status"})
+			}
+			notify(db, post.UserID, "post_"+newStatus,
+				fmt.Sprintf("Experts reviewed your post \"%s\": %s", post.Title, strings.ReplaceAll(newStatus, "_", " ")), &post.ID)
+		}
+
+		return c.JSON(fiber.Map{
+			"message":         "Review saved",
+			"current_reviews": reviewCount,
+			"status":          newStatus,
+		})
+	}
+}
+
+// Get reviewer feedback on one of the current user's posts
+func GetPostReviews(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var post Post
+		if err := db.First(&post, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+		if post.UserID != userID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only view feedback on your own posts"})
+		}
+
+		return c.JSON(getPostReviews(db, post.ID))
+	}
+}
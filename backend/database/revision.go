@@ -0,0 +1,576 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dadadun/lifskill/storage"
+	"github.com/dadadun/lifskill/validation"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Revision statuses
+const (
+	RevisionArchived = "archived" // a previous live version of the post
+	RevisionPending  = "pending"  // a proposed edit of an approved post awaiting review
+	RevisionApplied  = "applied"  // a proposed edit that experts approved
+	RevisionRejected = "rejected" // a proposed edit that experts rejected
+)
+
+// PostRevision stores either a previous version of a post or a proposed
+// edit that has to go through expert review before going live
+type PostRevision struct {
+	gorm.Model
+	PostID            uint   `gorm:"not null;index"`
+	Version           int    `gorm:"not null"`
+	Status            string `gorm:"size:20;not null"`
+	Title             string `gorm:"size:150;not null"`
+	Content           string `gorm:"type:text;not null"`
+	Picture           string `gorm:"size:255"`
+	YouTubeLink       string `gorm:"size:255"`
+	RecommendAgeRange string `gorm:"size:50"`
+	CategoryIDs       string `gorm:"size:255"` // comma separated category IDs
+	Difficulty        string `gorm:"size:20"`
+	Tutorial          string `gorm:"type:text"` // steps and materials as JSON, see tutorialSnapshot
+	EditedByID        uint   `gorm:"not null"`
+
+	Post Post `gorm:"foreignKey:PostID;references:ID"`
+}
+
+// PostRevisionReview is an expert's verdict on a pending revision
+type PostRevisionReview struct {
+	RevisionID uint      `gorm:"primaryKey"`
+	UserID     uint      `gorm:"primaryKey"`
+	Decision   string    `gorm:"size:20;not null"`
+	Reason     string    `gorm:"type:text"`
+	ReviewedAt time.Time `gorm:"not null;default:current_timestamp"`
+
+	Revision PostRevision `gorm:"foreignKey:RevisionID;references:ID"`
+	User     User         `gorm:"foreignKey:UserID;references:ID"`
+}
+
+// Input for editing a post; nil fields are left unchanged
+type UpdatePostRequest struct {
+	Title             *string `json:"title" validate:"required,max=150"`
+	Content           *string `json:"content" validate:"required"`
+	YouTubeLink       *string `json:"youtube_link" validate:"omitempty,url,max=255"`
+	RecommendAgeRange *string `json:"RecommendAgeRange" validate:"omitempty,agerange,max=50"`
+	Categories        *[]uint `json:"Categories" validate:"min=1"`
+
+	Difficulty *string                  `json:"difficulty" validate:"omitempty,oneof=beginner intermediate advanced"`
+	Steps      *[]UpdateStepRequest     `json:"steps" validate:"max=50,dive"`
+	Materials  *[]CreateMaterialRequest `json:"materials" validate:"max=100,dive"`
+}
+
+type PostRevisionDTO struct {
+	ID                uint               `json:"id"`
+	Version           int                `json:"version"`
+	Status            string             `json:"status"`
+	Title             string             `json:"title"`
+	Content           string             `json:"content"`
+	Picture           *storage.ImageURLs `json:"picture"`
+	YouTubeLink       string             `json:"youtube_link"`
+	RecommendAgeRange string             `json:"recommend_age_range"`
+	CategoryIDs       []uint             `json:"category_ids"`
+	Difficulty        string             `json:"difficulty,omitempty"`
+	Steps             []PostStepDTO      `json:"steps,omitempty"`
+	Materials         []PostMaterialDTO  `json:"materials,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+}
+
+// joinIDs sorts and joins IDs so equal sets compare equal
+func joinIDs(ids []uint) string {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	parts := make([]string, 0, len(sorted))
+	for _, id := range sorted {
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseIDs(s string) []uint {
+	ids := []uint{}
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+func categoryIDsOf(categories []Category) []uint {
+	ids := make([]uint, 0, len(categories))
+	for _, cat := range categories {
+		ids = append(ids, cat.ID)
+	}
+	return ids
+}
+
+func toPostRevisionDTO(r PostRevision) PostRevisionDTO {
+	steps, materials := parseTutorial(r.Tutorial).dtos()
+	return PostRevisionDTO{
+		ID:                r.ID,
+		Version:           r.Version,
+		Status:            r.Status,
+		Title:             r.Title,
+		Content:           r.Content,
+		Picture:           storage.ImageURLsFor(r.Picture),
+		YouTubeLink:       r.YouTubeLink,
+		RecommendAgeRange: r.RecommendAgeRange,
+		CategoryIDs:       parseIDs(r.CategoryIDs),
+		Difficulty:        r.Difficulty,
+		Steps:             steps,
+		Materials:         materials,
+		CreatedAt:         r.CreatedAt,
+	}
+}
+
+func nextRevisionVersion(tx *gorm.DB, postID uint) int {
+	var count int64
+	tx.Model(&PostRevision{}).Where("post_id = ?", postID).Count(&count)
+	return int(count) + 1
+}
+
+// archivePost snapshots the live version of a post into the revision table.
+// The post needs its categories, steps and materials loaded.
+func archivePost(tx *gorm.DB, post Post, editorID uint) error {
+	return tx.Create(&PostRevision{
+		PostID:            post.ID,
+		Version:           nextRevisionVersion(tx, post.ID),
+		Status:            RevisionArchived,
+		Title:             post.Title,
+		Content:           post.Content,
+		Picture:           post.Picture,
+		YouTubeLink:       post.YouTubeLink,
+		RecommendAgeRange: post.RecommendAgeRange,
+		CategoryIDs:       joinIDs(categoryIDsOf(post.Categories)),
+		Difficulty:        post.Difficulty,
+		Tutorial:          snapshotTutorial(post.Steps, post.Materials).String(),
+		EditedByID:        editorID,
+	}).Error
+}
+
+// applyRevision copies a revision's content onto the live post
+func applyRevision(tx *gorm.DB, post *Post, r PostRevision) error {
+	fields := map[string]interface{}{
+		"title":               r.Title,
+		"content":             r.Content,
+		"picture":             r.Picture,
+		"you_tube_link":       r.YouTubeLink,
+		"recommend_age_range": r.RecommendAgeRange,
+	}
+	// Revisions saved before tutorials were versioned have no tutorial;
+	// they leave the live difficulty, steps and materials alone
+	if r.Tutorial != "" {
+		fields["difficulty"] = r.Difficulty
+		if err := applyTutorial(tx, post.ID, parseTutorial(r.Tutorial)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(post).Updates(fields).Error; err != nil {
+		return err
+	}
+
+	var categories []Category
+	if ids := parseIDs(r.CategoryIDs); len(ids) > 0 {
+		if err := tx.Where("id IN ?", ids).Find(&categories).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(post).Association("Categories").Replace(categories)
+}
+
+// Edit a post. Edits to posts that are not yet approved go live immediately
+// and restart review. Edits that change anything shown on an approved post,
+// including its video link, age range, steps and materials, are held as a
+// pending revision while the current version stays live.
+func UpdatePost(db *gorm.DB, store storage.Storage) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var post Post
+		if err := db.Preload("Categories").Preload("Steps", byPosition).Preload("Materials", byPosition).
+			First(&post, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+		if post.UserID != userID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not authorized to edit this post"})
+		}
+		if post.Status == "removed" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This post has been taken down"})
+		}
+
+		// Accept the same multipart layout as CreatePost, or a plain JSON body
+		input := new(UpdatePostRequest)
+		if postJSON := c.FormValue("post"); postJSON != "" {
+			if err := json.Unmarshal([]byte(postJSON), input); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Failed to parse post JSON: " + err.Error(),
+				})
+			}
+		} else if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if errs := validation.Struct(input); errs != nil {
+			return validation.Reply(c, errs)
+		}
+
+		// Build the proposed version on top of the current one
+		current := snapshotTutorial(post.Steps, post.Materials)
+		tutorial := current
+		proposed := PostRevision{
+			PostID:            post.ID,
+			Title:             post.Title,
+			Content:           post.Content,
+			Picture:           post.Picture,
+			YouTubeLink:       post.YouTubeLink,
+			RecommendAgeRange: post.RecommendAgeRange,
+			CategoryIDs:       joinIDs(categoryIDsOf(post.Categories)),
+			Difficulty:        post.Difficulty,
+			EditedByID:        userID,
+		}
+		if input.Title != nil {
+			proposed.Title = *input.Title
+		}
+		if input.Content != nil {
+			proposed.Content = *input.Content
+		}
+		if input.YouTubeLink != nil {
+			proposed.YouTubeLink = *input.YouTubeLink
+		}
+		if input.RecommendAgeRange != nil {
+			proposed.RecommendAgeRange = *input.RecommendAgeRange
+		}
+		if input.Difficulty != nil {
+			proposed.Difficulty = *input.Difficulty
+		}
+		if input.Materials != nil {
+			tutorial.Materials = []materialSnapshot{}
+			for _, m := range *input.Materials {
+				tutorial.Materials = append(tutorial.Materials, materialSnapshot{Name: m.Name, Quantity: m.Quantity})
+			}
+		}
+		if input.Categories != nil {
+			var count int64
+			db.Model(&Category{}).Where("id IN ?", *input.Categories).Count(&count)
+			if int(count) != len(*input.Categories) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Some categories not found"})
+			}
+			proposed.CategoryIDs = joinIDs(*input.Categories)
+		}
+
+		// Pictures that end up unused, such as new ones when saving fails,
+		// are released on the way out; keys still referenced are kept
+		var uploaded, unused []string
+		defer func() { releaseUploads(db, store, unused...) }()
+
+		if input.Steps != nil {
+			steps, keys, err := buildStepSnapshots(c, store, post.Steps, *input.Steps)
+			uploaded = append(uploaded, keys...)
+			if err != nil {
+				unused = uploaded
+				if errors.Is(err, errUnknownStep) {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Some steps not found"})
+				}
+				return uploadError(c, err)
+			}
+			tutorial.Steps = steps
+		}
+		proposed.Tutorial = tutorial.String()
+
+		if file, err := c.FormFile("picture"); err == nil && file != nil {
+			key, err := storage.SaveImage(store, file, "posts")
+			if err != nil {
+				unused = uploaded
+				return uploadError(c, err)
+			}
+			uploaded = append(uploaded, key)
+			proposed.Picture = key
+		}
+
+		substantive := proposed.Title != post.Title ||
+			proposed.Content != post.Content ||
+			proposed.Picture != post.Picture ||
+			proposed.YouTubeLink != post.YouTubeLink ||
+			proposed.RecommendAgeRange != post.RecommendAgeRange ||
+			proposed.CategoryIDs != joinIDs(categoryIDsOf(post.Categories)) ||
+			proposed.Difficulty != post.Difficulty ||
+			proposed.Tutorial != current.String()
+
+		if post.Status == "approved" && substantive {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if post.PendingRevisionID != nil {
+					// Replace the edit that is already waiting and restart its review
+					proposed.ID = *post.PendingRevisionID
+					var existing PostRevision
+					if err := tx.First(&existing, proposed.ID).Error; err != nil {
+						return err
+					}
+					proposed.CreatedAt = existing.CreatedAt
+					proposed.Version = existing.Version
+					unused = append(unused, existing.Picture)
+					unused = append(unused, parseTutorial(existing.Tutorial).stepKeys()...)
+					proposed.Status = RevisionPending
+					if err := tx.Where("revision_id = ?", proposed.ID).Delete(&PostRevisionReview{}).Error; err != nil {
+						return err
+					}
+					return tx.Save(&proposed).Error
+				}
+
+				proposed.Version = nextRevisionVersion(tx, post.ID)
+				proposed.Status = RevisionPending
+				if err := tx.Create(&proposed).Error; err != nil {
+					return err
+				}
+				return tx.Model(&post).Update("pending_revision_id", proposed.ID).Error
+			})
+			if err != nil {
+				unused = uploaded
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to submit edit"})
+			}
+
+			return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+				"message":  "Edit submitted for expert review; the current version stays live until approved",
+				"revision": toPostRevisionDTO(proposed),
+			})
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := archivePost(tx, post, userID); err != nil {
+				return err
+			}
+			if err := applyRevision(tx, &post, proposed); err != nil {
+				return err
+			}
+
+			// Posts that were not approved yet go back to the review queue
+			if post.Status != "approved" {
+				if err := tx.Where("post_id = ?", post.ID).Delete(&PostApproval{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("post_id = ?", post.ID).Delete(&PostReview{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&post).Updates(map[string]interface{}{
+					"status":               "pending",
+					"Total_Approved_Users": 0,
+				}).Error; err != nil {
+					return err
+				}
+				post.Status = "pending"
+			}
+			return nil
+		})
+		if err != nil {
+			unused = uploaded
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update post: " + err.Error()})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Post updated",
+			"status":  post.Status,
+		})
+	}
+}
+
+// List all revisions of a post (author, moderators and admins)
+func GetPostRevisions(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		role, _ := c.Locals("role").(string)
+
+		var post Post
+		if err := db.First(&post, c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+		if post.UserID != userID && !RoleAtLeast(role, RoleModerator) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot view this post's history"})
+		}
+
+		var revisions []PostRevision
+		if err := db.Where("post_id = ?", post.ID).Order("version desc").Find(&revisions).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revisions"})
+		}
+
+		result := []PostRevisionDTO{}
+		for _, r := range revisions {
+			result = append(result, toPostRevisionDTO(r))
+		}
+		return c.JSON(result)
+	}
+}
+
+// Get pending edits of approved posts for expert user to review
+func GetPendingRevisionsForExpert(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var user User
+		if err := db.Preload("ExpertCategories").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		expertCategoryIDs := categoryIDsOf(user.ExpertCategories)
+		if len(expertCategoryIDs) == 0 {
+			return c.JSON([]PostRevisionDTO{})
+		}
+
+		var revisions []PostRevision
+		err := db.Joins("JOIN posts ON posts.id = post_revisions.post_id").
+			Joins("JOIN post_categories pc ON pc.post_id = posts.id").
+			Where("post_revisions.status = ? AND pc.category_id IN ? AND posts.user_id != ?", RevisionPending, expertCategoryIDs, userID).
+			Where("post_revisions.id NOT IN (SELECT revision_id FROM post_revision_reviews WHERE user_id = ?)", userID).
+			Group("post_revisions.id").
+			Order("post_revisions.created_at desc").
+			Find(&revisions).Error
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch pending revisions"})
+		}
+
+		result := []PostRevisionDTO{}
+		for _, r := range revisions {
+			result = append(result, toPostRevisionDTO(r))
+		}
+		return c.JSON(result)
+	}
+}
+
+var errPostRemoved = errors.New("post has been taken down")
+
+// Approve or reject a pending revision as an expert in the post's category
+func ReviewPostRevision(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var input struct {
+			Decision string `json:"decision"` // "approved" or "rejected"
+			Reason   string `json:"reason"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if input.Decision != "approved" && input.Decision != ReviewRejected {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "decision must be approved or rejected"})
+		}
+		if input.Decision == ReviewRejected && strings.TrimSpace(input.Reason) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A reason is required"})
+		}
+
+		var revision PostRevision
+		if err := db.First(&revision, c.Params("id")).Error; err != nil || revision.Status != RevisionPending {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pending revision not found"})
+		}
+
+		var post Post
+		if err := db.Preload("Categories").Preload("Steps", byPosition).Preload("Materials", byPosition).
+			First(&post, revision.PostID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+		}
+		if post.UserID == userID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot review your own post"})
+		}
+
+		var user User
+		if err := db.Preload("ExpertCategories").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		isExpert := false
+		for _, postCat := range post.Categories {
+			for _, expertCat := range user.ExpertCategories {
+				if postCat.ID == expertCat.ID {
+					isExpert = true
+					break
+				}
+			}
+		}
+		if !isExpert {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not an expert in this post's category"})
+		}
+
+		var existing PostRevisionReview
+		if err := db.Where("revision_id = ? AND user_id = ?", revision.ID, userID).First(&existing).Error; err == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You have already reviewed this revision"})
+		}
+
+		review := PostRevisionReview{
+			RevisionID: revision.ID,
+			UserID:     userID,
+			Decision:   input.Decision,
+			Reason:     strings.TrimSpace(input.Reason),
+			ReviewedAt: time.Now(),
+		}
+		if err := db.Create(&review).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+		}
+
+		var approverIDs []uint
+		var rejections int64
+		db.Model(&PostRevisionReview{}).Where("revision_id = ? AND decision = ?", revision.ID, "approved").Pluck("user_id", &approverIDs)
+		db.Model(&PostRevisionReview{}).Where("revision_id = ? AND decision = ?", revision.ID, ReviewRejected).Count(&rejections)
+		approvals := len(approverIDs)
+
+		approved, policy := EvaluateApproval(db, post.Categories, approverIDs)
+		if approved {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				// A moderator may have taken the post down since the edit
+				// was submitted; that must not be undone by the edit
+				var current Post
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Select("id", "status").First(&current, post.ID).Error; err != nil {
+					return err
+				}
+				if current.Status == "removed" {
+					return errPostRemoved
+				}
+				if err := archivePost(tx, post, post.UserID); err != nil {
+					return err
+				}
+				if err := applyRevision(tx, &post, revision); err != nil {
+					return err
+				}
+				if err := tx.Model(&revision).Update("status", RevisionApplied).Error; err != nil {
+					return err
+				}
+				return tx.Model(&post).Update("pending_revision_id", nil).Error
+			})
+			if errors.Is(err, errPostRemoved) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This post has been taken down"})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to apply revision"})
+			}
+			revision.Status = RevisionApplied
+			notify(db, post.UserID, "revision_applied",
+				fmt.Sprintf("Your edit to \"%s\" was approved and is now live", post.Title), &post.ID)
+		} else if rejections >= int64(policy.RequiredApprovals) {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&revision).Update("status", RevisionRejected).Error; err != nil {
+					return err
+				}
+				return tx.Model(&post).Update("pending_revision_id", nil).Error
+			})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reject revision"})
+			}
+			revision.Status = RevisionRejected
+			notify(db, post.UserID, "revision_rejected",
+				fmt.Sprintf("Your edit to \"%s\" was rejected by experts", post.Title), &post.ID)
+		}
+
+		return c.JSON(fiber.Map{
+			"message":    "Review saved",
+			"approvals":  approvals,
+			"rejections": rejections,
+			"status":     revision.Status,
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package database
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Highlighted matches are wrapped in these markers; the rest of the text
+// is HTML-escaped
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// ts_headline wraps matches in these control characters instead, so its
+// output can be escaped before they are turned into highlight markers
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+// postSearchVectorSQL builds a post's search document: title first, then
+// category names, then content. The "simple" configuration keeps Thai and
+// English words as typed, since there is no stemmer for Thai.
+const postSearchVectorSQL = `
+	setweight(to_tsvector('simple', coalesce(p.title, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce((
+		SELECT string_agg(c.categories_name, ' ')
+		FROM post_categories pc
+		JOIN categories c ON c.id = pc.category_id AND c.deleted_at IS NULL
+		WHERE pc.post_id = p.id
+	), '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(p.content, '')), 'C')`
+
+// setupSearch adds posts.search_vector with its GIN index and the triggers
+// that keep it current when a post, its categories or a category name
+// change. Category names live in other tables, so a generated column
+// can't cover them.
+func setupSearch(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector)`,
+		`CREATE OR REPLACE FUNCTION post_search_vector(bigint) RETURNS tsvector AS $$
+			SELECT ` + postSearchVectorSQL + ` FROM posts p WHERE p.id = $1
+		$$ LANGUAGE sql STABLE`,
+		`CREATE OR REPLACE FUNCTION posts_search_vector_trigger() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector := (SELECT ` + postSearchVectorSQL + ` FROM (SELECT NEW.id AS id, NEW.title AS title, NEW.content AS content) p);
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS posts_search_vector_update ON posts`,
+		`CREATE TRIGGER posts_search_vector_update BEFORE INSERT OR UPDATE OF title, content ON posts
+			FOR EACH ROW EXECUTE FUNCTION posts_search_vector_trigger()`,
+		`CREATE OR REPLACE FUNCTION post_categories_search_vector_trigger() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP IN ('UPDATE', 'DELETE') THEN
+				UPDATE posts SET search_vector = post_search_vector(OLD.post_id) WHERE id = OLD.post_id;
+			END IF;
+			IF TG_OP IN ('INSERT', 'UPDATE') THEN
+				UPDATE posts SET search_vector = post_search_vector(NEW.post_id) WHERE id = NEW.post_id;
+			END IF;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS post_categories_search_vector_update ON post_categories`,
+		`CREATE TRIGGER post_categories_search_vector_update AFTER INSERT OR UPDATE OR DELETE ON post_categories
+			FOR EACH ROW EXECUTE FUNCTION post_categories_search_vector_trigger()`,
+		`CREATE OR REPLACE FUNCTION categories_search_vector_trigger() RETURNS trigger AS $$
+		BEGIN
+			UPDATE posts SET search_vector = post_search_vector(posts.id)
+			WHERE id IN (SELECT post_id FROM post_categories WHERE category_id = NEW.id);
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS categories_search_vector_update ON categories`,
+		`CREATE TRIGGER categories_search_vector_update AFTER UPDATE OF categories_name, deleted_at ON categories
+			FOR EACH ROW EXECUTE FUNCTION categories_search_vector_trigger()`,
+		`UPDATE posts SET search_vector = post_search_vector(id) WHERE search_vector IS NULL`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchTerm is one word or quoted phrase from a search query
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// maxSearchTerms caps the terms of one query; every term adds a clause,
+// and for Thai a substring scan, so further terms are ignored
+const maxSearchTerms = 8
+
+// parseSearchQuery splits a query into at most maxSearchTerms terms.
+// "quoted text" is a phrase and a trailing * makes a word match as a
+// prefix.
+func parseSearchQuery(q string) []searchTerm {
+	var terms []searchTerm
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if words := searchWords(part); len(words) > 0 {
+				terms = append(terms, searchTerm{words: words})
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			prefix := strings.HasSuffix(field, "*")
+			for _, word := range searchWords(field) {
+				terms = append(terms, searchTerm{words: []string{word}, prefix: prefix})
+			}
+		}
+	}
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// searchWords keeps only letters and digits (and Thai combining marks),
+// so nothing in the query can be read as a tsquery operator
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// toTSQuery renders terms for to_tsquery: terms are ANDed, phrase words
+// must be adjacent
+func toTSQuery(terms []searchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		part := strings.Join(term.words, " <-> ")
+		if term.prefix {
+			part += ":*"
+		}
+		if len(term.words) > 1 {
+			part = "(" + part + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " & ")
+}
+
+// containsThai reports whether the query has Thai script. Thai is written
+// without spaces between words, so the tsvector only holds whole runs of
+// text and such queries fall back to substring matching.
+func containsThai(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Thai, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBySearch narrows a posts query to matches for terms. It returns
+// the relevance ordering and the tsquery used, which is "" when the query
+// fell back to substring matching.
+func filterBySearch(db *gorm.DB, query *gorm.DB, q string, terms []searchTerm) (*gorm.DB, clause.OrderBy, string) {
+	if containsThai(q) {
+		var titlePattern string
+		for i, term := range terms {
+			pattern := "%" + escapeLike(strings.Join(term.words, " ")) + "%"
+			if i == 0 {
+				titlePattern = pattern
+			}
+			query = query.Where("(posts.title ILIKE ? OR posts.content ILIKE ? OR posts.id IN (?))",
+				pattern, pattern,
+				db.Table("post_categories pc").
+					Select("pc.post_id").
+					Joins("JOIN categories c ON c.id = pc.category_id").
+					Where("c.categories_name ILIKE ?", pattern))
+		}
+		// Title matches first
+		return query, clause.OrderBy{Expression: clause.Expr{
+			SQL:                "CASE WHEN posts.title ILIKE ? THEN 0 ELSE 1 END, posts.created_at DESC",
+			Vars:               []interface{}{titlePattern},
+			WithoutParentheses: true,
+		}}, ""
+	}
+
+	tsquery := toTSQuery(terms)
+	return query.Where("posts.search_vector @@ to_tsquery('simple', ?)", tsquery),
+		clause.OrderBy{Expression: clause.Expr{
+			SQL:                "ts_rank_cd(posts.search_vector, to_tsquery('simple', ?)) DESC, posts.created_at DESC",
+			Vars:               []interface{}{tsquery},
+			WithoutParentheses: true,
+		}}, tsquery
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+type SearchHighlightDTO struct {
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`
+}
+
+// searchHighlights returns ts_headline output for the given posts, keyed
+// by post ID
+func searchHighlights(db *gorm.DB, postIDs []uint, tsquery string) map[uint]*SearchHighlightDTO {
+	var rows []struct {
+		ID      uint
+		Title   string
+		Snippet string
+	}
+	options := `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `"`
+	db.Raw(`SELECT id,
+			ts_headline('simple', title, to_tsquery('simple', @q), @title) AS title,
+			ts_headline('simple', content, to_tsquery('simple', @q), @snippet) AS snippet
+		FROM posts WHERE id IN @ids`, map[string]interface{}{
+		"q":       tsquery,
+		"ids":     postIDs,
+		"title":   options + ", HighlightAll=true",
+		"snippet": options + ", MaxFragments=2, MaxWords=25, MinWords=10",
+	}).Scan(&rows)
+
+	highlights := make(map[uint]*SearchHighlightDTO, len(rows))
+	for _, row := range rows {
+		highlights[row.ID] = &SearchHighlightDTO{Title: markHeadline(row.Title), Snippet: markHeadline(row.Snippet)}
+	}
+	return highlights
+}
+
+// markHeadline escapes ts_headline output and turns its match markers
+// into highlight markers
+func markHeadline(s string) string {
+	return strings.NewReplacer(headlineStart, highlightStart, headlineStop, highlightStop).
+		Replace(html.EscapeString(s))
+}
+
+// substringHighlight marks every occurrence of the terms in text and
+// escapes the rest. With window > 0 it returns at most window runes
+// around the first match.
+func substringHighlight(text string, terms []searchTerm, window int) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		needle := []rune(strings.Join(term.words, " "))
+		if len(needle) == 0 || len(lower) != len(runes) {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) != string(needle) {
+				continue
+			}
+			for j := i; j < i+len(needle); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start, end := 0, len(runes)
+	if window > 0 && len(runes) > window {
+		start = first - window/3
+		if start < 0 {
+			start = 0
+		}
+		end = start + window
+		if end > len(runes) {
+			end = len(runes)
+			start = end - window
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString(highlightStart)
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			b.WriteString(highlightStop)
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func word(w string) searchTerm {
+	return searchTerm{words: []string{w}}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []searchTerm
+	}{
+		{"empty", "  ", nil},
+		{"words are lowercased", "Tie KNOTS", []searchTerm{word("tie"), word("knots")}},
+		{"phrase", `"square knot" rope`, []searchTerm{{words: []string{"square", "knot"}}, word("rope")}},
+		{"unclosed phrase", `rope "square knot`, []searchTerm{word("rope"), {words: []string{"square", "knot"}}}},
+		{"empty phrase", `"" rope`, []searchTerm{word("rope")}},
+		{"trailing star is a prefix", "kno* rope", []searchTerm{{words: []string{"kno"}, prefix: true}, word("rope")}},
+		{"star inside a phrase is dropped", `"kno*"`, []searchTerm{word("kno")}},
+		{"operators are removed", "a&b | !c <-> (d):*", []searchTerm{word("a"), word("b"), word("c"), {words: []string{"d"}, prefix: true}}},
+		{"thai", "ผูกเชือก", []searchTerm{word("ผูกเชือก")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSearchQuery(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryCapsTerms(t *testing.T) {
+	got := parseSearchQuery("a b c d e f g h i j")
+	if len(got) != maxSearchTerms {
+		t.Fatalf("got %d terms, want %d", len(got), maxSearchTerms)
+	}
+	if last := got[len(got)-1].words[0]; last != "h" {
+		t.Fatalf("expected the first terms to be kept, last is %q", last)
+	}
+}
+
+func TestToTSQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"knot", "knot"},
+		{"tie knot", "tie & knot"},
+		{"kno*", "kno:*"},
+		{`"square knot" tie*`, "(square <-> knot) & tie:*"},
+		{"a&b | !c", "a & b & c"},
+	}
+	for _, tt := range tests {
+		if got := toTSQuery(parseSearchQuery(tt.in)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestContainsThai(t *testing.T) {
+	tests := map[string]bool{
+		"knot":         false,
+		"":             false,
+		"ผูกเชือก":     true,
+		"knot ผูก":     true,
+		"café naïve 1": false,
+	}
+	for in, want := range tests {
+		if got := containsThai(in); got != want {
+			t.Errorf("%q: got %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestSubstringHighlight(t *testing.T) {
+	xs := strings.Repeat("x", 20)
+	tests := []struct {
+		name   string
+		text   string
+		q      string
+		window int
+		want   string
+	}{
+		{"every match", "knot a knot", "knot", 0, "<mark>knot</mark> a <mark>knot</mark>"},
+		{"case insensitive", "Square KNOT", "knot", 0, "Square <mark>KNOT</mark>"},
+		{"overlapping terms merge", "knots", "kno ots", 0, "<mark>knots</mark>"},
+		{"phrase", "a square knot", `"square knot"`, 0, "a <mark>square knot</mark>"},
+		{"thai", "ผูกเชือกให้แน่น", "เชือก", 0, "ผูก<mark>เชือก</mark>ให้แน่น"},
+		{"escapes html", `<b>knot</b> & "rope"`, "knot", 0, "&lt;b&gt;<mark>knot</mark>&lt;/b&gt; &amp; &#34;rope&#34;"},
+		{"no match", "rope", "knot", 0, "rope"},
+		{"text fits the window", "a knot", "knot", 10, "a <mark>knot</mark>"},
+		{"window at the start", "knot " + xs, "knot", 10, "<mark>knot</mark> xxxxx..."},
+		{"window at the end", xs + " knot", "knot", 10, "...xxxxx <mark>knot</mark>"},
+		{"window in the middle", xs + " knot " + xs, "knot", 10, "...xx <mark>knot</mark> xx..."},
+		{"window without a match", xs, "knot", 10, "xxxxxxxxxx..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := substringHighlight(tt.text, parseSearchQuery(tt.q), tt.window)
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkHeadline(t *testing.T) {
+	in := "<i>" + headlineStart + "knot" + headlineStop + "</i> & rope"
+	want := "&lt;i&gt;<mark>knot</mark>&lt;/i&gt; &amp; rope"
+	if got := markHeadline(in); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
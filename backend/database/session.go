@@ -0,0 +1,321 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dadadun/lifskill/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Session is one logged-in device. The refresh token is only stored hashed
+// and is rotated on every refresh.
+type Session struct {
+	gorm.Model
+	UserID            uint       `gorm:"not null;index"`
+	RefreshTokenHash  string     `gorm:"size:64;not null;uniqueIndex"`
+	PreviousTokenHash string     `gorm:"size:64;index"`
+	ExpiresAt         time.Time  `gorm:"not null"`
+	LastUsedAt        time.Time  `gorm:"not null"`
+	RotatedAt         *time.Time `gorm:"default:null"` // when PreviousTokenHash was replaced
+	RevokedAt         *time.Time `gorm:"default:null"`
+	UserAgent         string     `gorm:"size:255"`
+	IPAddress         string     `gorm:"size:64"`
+	User              User       `gorm:"foreignKey:UserID;references:ID"`
+}
+
+type SessionDTO struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+func accessTokenTTL() time.Duration {
+	return time.Duration(config.AppConfig.AccessTokenTTLMinutes) * time.Minute
+}
+
+func refreshTokenTTL() time.Duration {
+	return time.Duration(config.AppConfig.RefreshTokenTTLHours) * time.Hour
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// signAccessToken signs a short-lived JWT bound to a session
+func signAccessToken(user User, sessionID uint) (string, error) {
+	claims := Claims{
+		Role: user.Role,
+		StandardClaims: jwt.StandardClaims{
+			Id:        strconv.FormatUint(uint64(sessionID), 10),
+			Subject:   strconv.Itoa(int(user.ID)), // ใช้ userID เป็น Subject
+			ExpiresAt: time.Now().Add(accessTokenTTL()).Unix(),
+		},
+	}
+	key, err := JWTKey()
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// setAuthCookies sets the access token cookie and, unless refreshToken is
+// empty, the refresh token cookie
+func setAuthCookies(c *fiber.Ctx, accessToken, refreshToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    accessToken,
+		Expires:  time.Now().Add(accessTokenTTL()),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   true,
+	})
+	if refreshToken == "" {
+		return
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Path:     "/auth",
+		Expires:  time.Now().Add(refreshTokenTTL()),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   true,
+	})
+}
+
+func clearAuthCookies(c *fiber.Ctx) {
+	// Clear the cookies by setting expired cookies with the same names
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour), // Set expiration to the past
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   false,
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/auth",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   false,
+	})
+}
+
+// startSession creates a session for the user and sets both auth cookies
+func startSession(db *gorm.DB, c *fiber.Ctx, user User) error {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        now.Add(refreshTokenTTL()),
+		LastUsedAt:       now,
+		UserAgent:        truncate(c.Get(fiber.HeaderUserAgent), 255),
+		IPAddress:        c.IP(),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return err
+	}
+
+	accessToken, err := signAccessToken(user, session.ID)
+	if err != nil {
+		return err
+	}
+
+	setAuthCookies(c, accessToken, refreshToken)
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// IsSessionActive reports whether the session behind an access token is
+// still valid for the user
+func IsSessionActive(db *gorm.DB, sessionID string, userID uint) bool {
+	if sessionID == "" {
+		return false
+	}
+	var count int64
+	db.Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// RevokeUserSessions revokes every active session of a user except the
+// one with exceptID (pass 0 to revoke all)
+func RevokeUserSessions(db *gorm.DB, userID uint, exceptID uint) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND id <> ?", userID, exceptID).
+		Update("revoked_at", time.Now()).Error
+}
+
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// refreshGracePeriod is how long the refresh token that was just rotated
+// away still gets an access token, so parallel refreshes from one browser
+// don't look like a stolen token
+const refreshGracePeriod = 30 * time.Second
+
+// Exchange the refresh token cookie for a new access token and a new
+// refresh token. Presenting an already rotated refresh token revokes the
+// session, since it means the token was copied, unless it was rotated
+// within refreshGracePeriod; then only a new access token is issued.
+func RefreshSession(db *gorm.DB, c *fiber.Ctx) error {
+	refreshToken := c.Cookies("refresh_token")
+	if refreshToken == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing refresh token"})
+	}
+	tokenHash := hashToken(refreshToken)
+
+	var session Session
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so concurrent refreshes rotate one after the other
+		locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		if err := locked.Where("refresh_token_hash = ?", tokenHash).First(&session).Error; err != nil {
+			if err := locked.Where("previous_token_hash = ?", tokenHash).First(&session).Error; err != nil {
+				return err
+			}
+			if session.RotatedAt == nil || time.Since(*session.RotatedAt) > refreshGracePeriod {
+				return errRefreshTokenReused
+			}
+			if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+				return gorm.ErrRecordNotFound
+			}
+			// The browser already holds the newer refresh token
+			refreshToken = ""
+			return nil
+		}
+		if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+			return gorm.ErrRecordNotFound
+		}
+
+		newToken, err := newRefreshToken()
+		if err != nil {
+			return err
+		}
+		refreshToken = newToken
+		now := time.Now()
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"previous_token_hash": tokenHash,
+			"refresh_token_hash":  hashToken(newToken),
+			"last_used_at":        now,
+			"rotated_at":          now,
+		}).Error
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		db.Model(&session).Update("revoked_at", time.Now())
+	}
+	if err != nil {
+		clearAuthCookies(c)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired refresh token"})
+	}
+
+	var user User
+	if err := db.First(&user, session.UserID).Error; err != nil || user.Suspended {
+		RevokeUserSessions(db, session.UserID, 0)
+		clearAuthCookies(c)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account is suspended or no longer exists"})
+	}
+
+	accessToken, err := signAccessToken(user, session.ID)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	setAuthCookies(c, accessToken, refreshToken)
+	return c.JSON(fiber.Map{"message": "success"})
+}
+
+// List the current user's active sessions
+func GetMySessions(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		currentID, _ := c.Locals("sessionID").(uint)
+
+		var sessions []Session
+		if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+			Order("last_used_at desc").
+			Find(&sessions).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+		}
+
+		result := []SessionDTO{}
+		for _, s := range sessions {
+			result = append(result, SessionDTO{
+				ID:         s.ID,
+				UserAgent:  s.UserAgent,
+				IPAddress:  s.IPAddress,
+				CreatedAt:  s.CreatedAt,
+				LastUsedAt: s.LastUsedAt,
+				Current:    s.ID == currentID,
+			})
+		}
+		return c.JSON(result)
+	}
+}
+
+// Revoke one of the current user's sessions
+func RevokeSession(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		result := db.Model(&Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), userID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Session revoked"})
+	}
+}
+
+// Log out of every device, including this one
+func LogoutAllSessions(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		if err := RevokeUserSessions(db, userID, 0); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+		}
+
+		clearAuthCookies(c)
+		return c.JSON(fiber.Map{"message": "Logged out of all devices"})
+	}
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// suggestLimit caps each group of search suggestions
+const suggestLimit = 5
+
+// Suggestions are fetched on every keystroke, so input past these limits
+// gets no suggestions, or no correction, rather than more queries
+const (
+	maxSuggestRunes   = 100
+	maxCorrectedWords = 5
+)
+
+// setupSuggest enables pg_trgm for fuzzy matching of titles, category
+// names and usernames, and keeps search_words, the vocabulary of approved
+// posts used for "did you mean" corrections. It must run after setupSearch.
+func setupSuggest(db *gorm.DB) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_title_trgm ON posts USING GIN (title gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING GIN (categories_name gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING GIN (username gin_trgm_ops)`,
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS search_words AS
+			SELECT word, ndoc FROM ts_stat($$SELECT search_vector FROM posts WHERE status = 'approved' AND deleted_at IS NULL$$)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_search_words_word ON search_words (word)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_words_word_trgm ON search_words USING GIN (word gin_trgm_ops)`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshSearchWords rebuilds the "did you mean" vocabulary
+func RefreshSearchWords(db *gorm.DB) error {
+	return db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY search_words`).Error
+}
+
+// StartSearchWordsJob refreshes the search vocabulary right away and then
+// every interval, until ctx is done. interval must be positive.
+func StartSearchWordsJob(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go runPeriodically(ctx, db, interval, "search words", RefreshSearchWords)
+}
+
+type PostSuggestionDTO struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+type SuggestionsDTO struct {
+	Posts      []PostSuggestionDTO `json:"posts"`
+	Categories []CategoryDTO       `json:"categories"`
+	Users      []UserDTO           `json:"users"`
+	DidYouMean *string             `json:"did_you_mean"`
+}
+
+// correctQuery replaces each word of q that isn't in the vocabulary with
+// its closest known word. It returns "" when nothing could be corrected,
+// or when q has more than maxCorrectedWords words.
+func correctQuery(db *gorm.DB, terms []searchTerm) string {
+	words := 0
+	for _, term := range terms {
+		words += len(term.words)
+	}
+	if words > maxCorrectedWords {
+		return ""
+	}
+
+	changed := false
+	corrected := make([]searchTerm, len(terms))
+	for i, term := range terms {
+		corrected[i] = searchTerm{words: make([]string, len(term.words)), prefix: term.prefix}
+		for j, word := range term.words {
+			corrected[i].words[j] = word
+
+			var known int64
+			db.Table("search_words").Where("word = ?", word).Count(&known)
+			if known > 0 {
+				continue
+			}
+			var best []string
+			db.Table("search_words").
+				Where("word % ?", word).
+				Order(clause.OrderBy{Expression: gorm.Expr("similarity(word, ?) DESC, ndoc DESC", word)}).
+				Limit(1).
+				Pluck("word", &best)
+			if len(best) > 0 {
+				corrected[i].words[j] = best[0]
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	parts := make([]string, len(corrected))
+	for i, term := range corrected {
+		part := strings.Join(term.words, " ")
+		if len(term.words) > 1 {
+			part = `"` + part + `"`
+		}
+		if term.prefix {
+			part += "*"
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, " ")
+}
+
+// countSearchResults counts approved posts matching q the way SearchPosts
+// does
+func countSearchResults(db *gorm.DB, q string, terms []searchTerm) int64 {
+	query, _, _ := filterBySearch(db, db.Model(&Post{}).Where("posts.status = ?", "approved"), q, terms)
+	var count int64
+	query.Count(&count)
+	return count
+}
+
+// Search-as-you-type suggestions: post titles, category names and
+// usernames ranked by trigram similarity. When the query has no search
+// results, did_you_mean holds a corrected query that does.
+func SuggestSearch(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		q := strings.TrimSpace(c.Query("q"))
+		result := SuggestionsDTO{
+			Posts:      []PostSuggestionDTO{},
+			Categories: []CategoryDTO{},
+			Users:      []UserDTO{},
+		}
+		if n := len([]rune(q)); n < 2 || n > maxSuggestRunes {
+			return c.JSON(result)
+		}
+		pattern := "%" + escapeLike(q) + "%"
+
+		var posts []Post
+		if err := db.Select("id", "title").
+			Where("status = ? AND (title ILIKE ? OR ? <% title)", "approved", pattern, q).
+			Order(clause.OrderBy{Expression: gorm.Expr("word_similarity(?, title) DESC, \"like\" DESC", q)}).
+			Limit(suggestLimit).
+			Find(&posts).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch suggestions"})
+		}
+		for _, post := range posts {
+			result.Posts = append(result.Posts, PostSuggestionDTO{ID: post.ID, Title: post.Title})
+		}
+
+		var categories []Category
+		db.Where("categories_name ILIKE ? OR ? <% categories_name", pattern, q).
+			Order(clause.OrderBy{Expression: gorm.Expr("word_similarity(?, categories_name) DESC", q)}).
+			Limit(suggestLimit).
+			Find(&categories)
+		for _, cat := range categories {
+			result.Categories = append(result.Categories, CategoryDTO{ID: cat.ID, CategoriesName: cat.CategoriesName})
+		}
+
+		var users []User
+		db.Where("suspended = ? AND (username ILIKE ? OR ? <% username)", false, pattern, q).
+			Order(clause.OrderBy{Expression: gorm.Expr("word_similarity(?, username) DESC", q)}).
+			Limit(suggestLimit).
+			Find(&users)
+		for _, user := range users {
+			result.Users = append(result.Users, toUserDTO(user))
+		}
+
+		// Only offer a correction that actually finds something. Checking
+		// costs two searches, so skip it when there is nothing to correct.
+		terms := parseSearchQuery(q)
+		if len(terms) > 0 && len(terms) <= maxCorrectedWords && countSearchResults(db, q, terms) == 0 {
+			if corrected := correctQuery(db, terms); corrected != "" &&
+				countSearchResults(db, corrected, parseSearchQuery(corrected)) > 0 {
+				result.DidYouMean = &corrected
+			}
+		}
+
+		return c.JSON(result)
+	}
+}
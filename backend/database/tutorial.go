@@ -0,0 +1,310 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dadadun/lifskill/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Difficulty levels of a tutorial
+const (
+	DifficultyBeginner     = "beginner"
+	DifficultyIntermediate = "intermediate"
+	DifficultyAdvanced     = "advanced"
+)
+
+// PostStep is one step of a step-by-step tutorial post
+type PostStep struct {
+	gorm.Model
+	PostID          uint   `gorm:"not null;index"`
+	Position        int    `gorm:"not null"`
+	Text            string `gorm:"type:text;not null"`
+	Picture         string `gorm:"size:255"`
+	DurationMinutes int    `gorm:"not null;default:0"`
+}
+
+// PostMaterial is one item of a tutorial's materials or ingredients list
+type PostMaterial struct {
+	gorm.Model
+	PostID   uint   `gorm:"not null;index"`
+	Position int    `gorm:"not null"`
+	Name     string `gorm:"size:150;not null"`
+	Quantity string `gorm:"size:50"`
+}
+
+type CreateStepRequest struct {
+	Text            string `json:"text" validate:"required,max=2000"`
+	DurationMinutes int    `json:"duration_minutes" validate:"omitempty,min=1,max=1440"`
+}
+
+type CreateMaterialRequest struct {
+	Name     string `json:"name" validate:"required,max=150"`
+	Quantity string `json:"quantity" validate:"omitempty,max=50"`
+}
+
+// UpdateStepRequest is one step of an edited tutorial. ID names the
+// existing step it replaces, which keeps that step's picture (unless a new
+// one is sent) and learners' progress on it; 0 adds a new step.
+type UpdateStepRequest struct {
+	ID              uint   `json:"id"`
+	Text            string `json:"text" validate:"required,max=2000"`
+	DurationMinutes int    `json:"duration_minutes" validate:"omitempty,min=1,max=1440"`
+}
+
+type PostStepDTO struct {
+	ID              uint               `json:"id"`
+	Position        int                `json:"position"`
+	Text            string             `json:"text"`
+	Picture         *storage.ImageURLs `json:"picture"`
+	DurationMinutes int                `json:"duration_minutes"`
+}
+
+type PostMaterialDTO struct {
+	ID       uint   `json:"id"`
+	Position int    `json:"position"`
+	Name     string `json:"name"`
+	Quantity string `json:"quantity"`
+}
+
+// buildSteps turns the validated step input into rows, saving each step's
+// optional picture sent as the form file "step_image_<index>". On error it
+// still returns the steps built so far, so their pictures can be released.
+func buildSteps(c *fiber.Ctx, store storage.Storage, input []CreateStepRequest) ([]PostStep, error) {
+	steps := make([]PostStep, 0, len(input))
+	for i, in := range input {
+		step := PostStep{
+			Position:        i,
+			Text:            in.Text,
+			DurationMinutes: in.DurationMinutes,
+		}
+		if file, err := c.FormFile(fmt.Sprintf("step_image_%d", i)); err == nil {
+			key, err := storage.SaveImage(store, file, "posts")
+			if err != nil {
+				return steps, err
+			}
+			step.Picture = key
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func buildMaterials(input []CreateMaterialRequest) []PostMaterial {
+	materials := make([]PostMaterial, 0, len(input))
+	for i, in := range input {
+		materials = append(materials, PostMaterial{
+			Position: i,
+			Name:     in.Name,
+			Quantity: in.Quantity,
+		})
+	}
+	return materials
+}
+
+// tutorialSnapshot is the steps and materials of a post as stored in a
+// revision
+type tutorialSnapshot struct {
+	Steps     []stepSnapshot     `json:"steps"`
+	Materials []materialSnapshot `json:"materials"`
+}
+
+type stepSnapshot struct {
+	ID              uint   `json:"id,omitempty"` // 0 until the revision goes live
+	Text            string `json:"text"`
+	Picture         string `json:"picture,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+}
+
+type materialSnapshot struct {
+	Name     string `json:"name"`
+	Quantity string `json:"quantity,omitempty"`
+}
+
+func snapshotTutorial(steps []PostStep, materials []PostMaterial) tutorialSnapshot {
+	t := tutorialSnapshot{Steps: []stepSnapshot{}, Materials: []materialSnapshot{}}
+	for _, s := range steps {
+		t.Steps = append(t.Steps, stepSnapshot{
+			ID:              s.ID,
+			Text:            s.Text,
+			Picture:         s.Picture,
+			DurationMinutes: s.DurationMinutes,
+		})
+	}
+	for _, m := range materials {
+		t.Materials = append(t.Materials, materialSnapshot{Name: m.Name, Quantity: m.Quantity})
+	}
+	return t
+}
+
+func (t tutorialSnapshot) String() string {
+	data, _ := json.Marshal(t)
+	return string(data)
+}
+
+func parseTutorial(s string) tutorialSnapshot {
+	var t tutorialSnapshot
+	json.Unmarshal([]byte(s), &t)
+	return t
+}
+
+// stepKeys lists the storage keys of the snapshot's step pictures
+func (t tutorialSnapshot) stepKeys() []string {
+	keys := make([]string, 0, len(t.Steps))
+	for _, s := range t.Steps {
+		keys = append(keys, s.Picture)
+	}
+	return keys
+}
+
+// buildStepSnapshots turns edited step input into snapshot steps. Steps
+// that name an existing step keep its picture; a picture sent as the form
+// file "step_image_<index>" replaces it. New pictures are returned
+// separately, also on error, so the caller can release them.
+func buildStepSnapshots(c *fiber.Ctx, store storage.Storage, current []PostStep, input []UpdateStepRequest) ([]stepSnapshot, []string, error) {
+	byID := map[uint]PostStep{}
+	for _, s := range current {
+		byID[s.ID] = s
+	}
+
+	steps := make([]stepSnapshot, 0, len(input))
+	var uploaded []string
+	for i, in := range input {
+		step := stepSnapshot{Text: in.Text, DurationMinutes: in.DurationMinutes}
+		if in.ID != 0 {
+			existing, ok := byID[in.ID]
+			if !ok {
+				return nil, uploaded, errUnknownStep
+			}
+			step.ID = existing.ID
+			step.Picture = existing.Picture
+		}
+		if file, err := c.FormFile(fmt.Sprintf("step_image_%d", i)); err == nil {
+			key, err := storage.SaveImage(store, file, "posts")
+			if err != nil {
+				return nil, uploaded, err
+			}
+			uploaded = append(uploaded, key)
+			step.Picture = key
+		}
+		steps = append(steps, step)
+	}
+	return steps, uploaded, nil
+}
+
+var errUnknownStep = errors.New("step does not belong to this post")
+
+// applyTutorial makes the snapshot the post's live steps and materials.
+// Steps are updated in place by ID so learners keep their progress on
+// them; completions of removed steps are dropped.
+func applyTutorial(tx *gorm.DB, postID uint, t tutorialSnapshot) error {
+	var current []PostStep
+	if err := tx.Where("post_id = ?", postID).Find(&current).Error; err != nil {
+		return err
+	}
+	remaining := map[uint]bool{}
+	for _, s := range current {
+		remaining[s.ID] = true
+	}
+
+	for i, s := range t.Steps {
+		if remaining[s.ID] {
+			delete(remaining, s.ID)
+			if err := tx.Model(&PostStep{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+				"position":         i,
+				"text":             s.Text,
+				"picture":          s.Picture,
+				"duration_minutes": s.DurationMinutes,
+			}).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Create(&PostStep{
+			PostID:          postID,
+			Position:        i,
+			Text:            s.Text,
+			Picture:         s.Picture,
+			DurationMinutes: s.DurationMinutes,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	if len(remaining) > 0 {
+		removed := make([]uint, 0, len(remaining))
+		for id := range remaining {
+			removed = append(removed, id)
+		}
+		if err := tx.Where("step_id IN ?", removed).Delete(&StepCompletion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&PostStep{}, removed).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where("post_id = ?", postID).Delete(&PostMaterial{}).Error; err != nil {
+		return err
+	}
+	for i, m := range t.Materials {
+		if err := tx.Create(&PostMaterial{
+			PostID:   postID,
+			Position: i,
+			Name:     m.Name,
+			Quantity: m.Quantity,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toPostStepDTOs(steps []PostStep) []PostStepDTO {
+	result := []PostStepDTO{}
+	for _, s := range steps {
+		result = append(result, PostStepDTO{
+			ID:              s.ID,
+			Position:        s.Position,
+			Text:            s.Text,
+			Picture:         storage.ImageURLsFor(s.Picture),
+			DurationMinutes: s.DurationMinutes,
+		})
+	}
+	return result
+}
+
+// dtos converts a snapshot for display, numbering steps and materials in
+// order
+func (t tutorialSnapshot) dtos() ([]PostStepDTO, []PostMaterialDTO) {
+	steps := []PostStepDTO{}
+	for i, s := range t.Steps {
+		steps = append(steps, PostStepDTO{
+			ID:              s.ID,
+			Position:        i,
+			Text:            s.Text,
+			Picture:         storage.ImageURLsFor(s.Picture),
+			DurationMinutes: s.DurationMinutes,
+		})
+	}
+	materials := []PostMaterialDTO{}
+	for i, m := range t.Materials {
+		materials = append(materials, PostMaterialDTO{Position: i, Name: m.Name, Quantity: m.Quantity})
+	}
+	return steps, materials
+}
+
+func toPostMaterialDTOs(materials []PostMaterial) []PostMaterialDTO {
+	result := []PostMaterialDTO{}
+	for _, m := range materials {
+		result = append(result, PostMaterialDTO{
+			ID:       m.ID,
+			Position: m.Position,
+			Name:     m.Name,
+			Quantity: m.Quantity,
+		})
+	}
+	return result
+}
@@ -1,11 +1,13 @@
 package database
 
 import (
-	"fmt"
-	"os"
-	"strconv"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/dadadun/lifskill/mail"
+	"github.com/dadadun/lifskill/storage"
+	"github.com/dadadun/lifskill/validation"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -14,40 +16,212 @@ import (
 
 type User struct {
 	gorm.Model
-	Username         string             `gorm:"size:50;not null;unique" json:"username"`
-	Password         string             `gorm:"size:255;not null" json:"password"`
-	Email            string             `gorm:"size:100;not null;unique" json:"email"`
-	Age              int                `json:"age"`
-	Sex              string             `gorm:"size:10" json:"sex"`
-	Picture          string             `gorm:"size:255" json:"picture"`
-	Posts            []Post             `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
-	ExpertCategories []Category         `gorm:"many2many:user_expert_categories;"`
-	TotalAchievement []TotalAchievement `gorm:"many2many:Total_Achievement"`
-	PostApproval     []PostApproval     `gorm:"many2many:post_approval;"`
-	Comments         []Comment          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Username         string         `gorm:"size:50;not null;unique" json:"username"`
+	Password         string         `gorm:"size:255;not null" json:"-"`        // never serialized
+	Email            string         `gorm:"size:100;not null;unique" json:"-"` // only shown through PrivateUserDTO
+	Age              int            `json:"age"`
+	Sex              string         `gorm:"size:20" json:"sex"`
+	Picture          string         `gorm:"size:255" json:"picture"`
+	Role             string         `gorm:"size:20;not null;default:'member'" json:"role"`
+	Suspended        bool           `gorm:"default:false" json:"suspended"`
+	EmailVerified    bool           `gorm:"default:false" json:"email_verified"`
+	EmailVerifiedAt  *time.Time     `json:"email_verified_at"`
+	Posts            []Post         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	ExpertCategories []Category     `gorm:"many2many:user_expert_categories;"`
+	PostApproval     []PostApproval `gorm:"many2many:post_approval;"`
+	Comments         []Comment      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+
+	// Privacy settings
+	HideFromLeaderboards bool `gorm:"not null;default:false" json:"hide_from_leaderboards"`
+	ShowAge              bool `gorm:"not null;default:false" json:"show_age"`
+	ShowSex              bool `gorm:"not null;default:false" json:"show_sex"`
 }
 
-func CreateUser(db *gorm.DB, c *fiber.Ctx) error {
-	user := new(User)
-	if err := c.BodyParser(user); err != nil {
-		return err
+// User roles, from least to most privileged. Roles other than member are
+// only granted by admins through SetUserRole; declaring expert categories
+// on a profile does not make someone an expert.
+const (
+	RoleMember    = "member"
+	RoleExpert    = "expert"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleMember:    0,
+	RoleExpert:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// IsValidRole reports whether role is one of the known user roles
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role is as privileged as min.
+// An empty role (tokens issued before roles existed) counts as member.
+func RoleAtLeast(role, min string) bool {
+	if role == "" {
+		role = RoleMember
+	}
+	return roleRank[role] >= roleRank[min]
+}
+
+// Claims are the JWT access token claims; Id holds the session ID
+type Claims struct {
+	Role string `json:"role"`
+	jwt.StandardClaims
+}
+
+// PrivateUserDTO is the full view of a user, only returned to that user
+type PrivateUserDTO struct {
+	UserDTO
+	Email            string        `json:"email"`
+	Age              int           `json:"age"`
+	Sex              string        `json:"sex"`
+	Role             string        `json:"role"`
+	EmailVerified    bool          `json:"email_verified"`
+	ExpertCategories []CategoryDTO `json:"expert_categories"`
+	CreatedAt        time.Time     `json:"created_at"`
+	Privacy          PrivacyDTO    `json:"privacy"`
+}
+
+// PrivacyDTO holds the user's privacy settings
+type PrivacyDTO struct {
+	HideFromLeaderboards bool `json:"hide_from_leaderboards"`
+	ShowAge              bool `json:"show_age"`
+	ShowSex              bool `json:"show_sex"`
+}
+
+func toPrivateUserDTO(user User) PrivateUserDTO {
+	categories := []CategoryDTO{}
+	for _, cat := range user.ExpertCategories {
+		categories = append(categories, CategoryDTO{
+			ID:             cat.ID,
+			CategoriesName: cat.CategoriesName,
+		})
+	}
+
+	return PrivateUserDTO{
+		UserDTO:          toUserDTO(user),
+		Email:            user.Email,
+		Age:              user.Age,
+		Sex:              user.Sex,
+		Role:             user.Role,
+		EmailVerified:    user.EmailVerified,
+		ExpertCategories: categories,
+		CreatedAt:        user.CreatedAt,
+		Privacy: PrivacyDTO{
+			HideFromLeaderboards: user.HideFromLeaderboards,
+			ShowAge:              user.ShowAge,
+			ShowSex:              user.ShowSex,
+		},
+	}
+}
+
+// Update the current user's privacy settings; fields left out keep their
+// value
+func UpdatePrivacySettings(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var input struct {
+			HideFromLeaderboards *bool `json:"hide_from_leaderboards"`
+			ShowAge              *bool `json:"show_age"`
+			ShowSex              *bool `json:"show_sex"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+
+		updates := map[string]interface{}{}
+		if input.HideFromLeaderboards != nil {
+			updates["hide_from_leaderboards"] = *input.HideFromLeaderboards
+		}
+		if input.ShowAge != nil {
+			updates["show_age"] = *input.ShowAge
+		}
+		if input.ShowSex != nil {
+			updates["show_sex"] = *input.ShowSex
+		}
+		if len(updates) > 0 {
+			if err := db.Model(&User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update privacy settings"})
+			}
+		}
+
+		var user User
+		if err := db.First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.JSON(fiber.Map{
+			"message": "Privacy settings updated",
+			"privacy": toPrivateUserDTO(user).Privacy,
+		})
+	}
+}
+
+// Registration input
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Password string `json:"password" validate:"required,min=6,maxbytes=72"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Age      int    `json:"age" validate:"min=1,max=120"`
+	Sex      string `json:"sex" validate:"max=20"`
+}
+
+func CreateUser(db *gorm.DB, mailer mail.Sender, c *fiber.Ctx) error {
+	input := new(RegisterRequest)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	// Trim first, so the length rules apply to what is stored
+	input.Username = strings.TrimSpace(input.Username)
+	input.Email = strings.TrimSpace(input.Email)
+	if errs := validation.Struct(input); errs != nil {
+		return validation.Reply(c, errs)
 	}
 
 	// Encrypt the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
-	user.Password = string(hashedPassword)
+
+	// New accounts always start as unverified members
+	user := &User{
+		Username: input.Username,
+		Password: string(hashedPassword),
+		Email:    input.Email,
+		Age:      input.Age,
+		Sex:      input.Sex,
+		Role:     RoleMember,
+	}
 
 	// Create user
-	db.Create(user)
-	return c.JSON(user)
+	if err := db.Create(user).Error; err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username or email is already taken",
+		})
+	}
+
+	if err := sendVerificationEmail(db, mailer, *user); err != nil {
+		log.Printf("verification email for user %d: %v", user.ID, err)
+	}
+
+	return c.JSON(toPrivateUserDTO(*user))
 }
 
 // loginUser handles user login
 func LoginUser(db *gorm.DB, c *fiber.Ctx) error {
-	var input User
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
 	var user User
 
 	if err := c.BodyParser(&input); err != nil {
@@ -64,33 +238,21 @@ func LoginUser(db *gorm.DB, c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	// Create JWT token with StandardClaims
-	claims := jwt.StandardClaims{
-		Subject:   strconv.Itoa(int(user.ID)), // ใช้ userID เป็น Subject
-		ExpiresAt: time.Now().Add(72 * time.Hour).Unix(),
+	if user.Suspended {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is suspended",
+		})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	t, err := token.SignedString(JwtSecretKey)
-	if err != nil {
+	// Start a session: short-lived access token plus rotating refresh token
+	if err := startSession(db, c, user); err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	// Set JWT token in cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    t,
-		Expires:  time.Now().Add(72 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "Lax",
-		Secure:   true,
-	})
-
 	return c.JSON(fiber.Map{"message": "success"})
 }
 
-func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
+func UpdateUser(db *gorm.DB, mailer mail.Sender, store storage.Storage, c *fiber.Ctx) error {
 	// Get the current user ID from JWT
 	userID := c.Locals("userID").(uint)
 
@@ -104,10 +266,10 @@ func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
 
 	// Parse the incoming data
 	var input struct {
-		Username          string `form:"username"`
-		Email             string `form:"email"`
-		Age               int    `form:"age"`
-		Gender            string `form:"gender"`
+		Username          string `form:"username" validate:"omitempty,min=3,max=50"`
+		Email             string `form:"email" validate:"omitempty,email,max=100"`
+		Age               int    `form:"age" validate:"min=0,max=120"`
+		Gender            string `form:"gender" validate:"max=20"`
 		ExpertCategoryIDs []uint `form:"expertCategoryIDs"`
 	}
 
@@ -116,25 +278,34 @@ func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Invalid input data",
 		})
 	}
+	input.Username = strings.TrimSpace(input.Username)
+	input.Email = strings.TrimSpace(input.Email)
+	if errs := validation.Struct(&input); errs != nil {
+		return validation.Reply(c, errs)
+	}
 
-	// Check uploaded file (optional)
-	file, err := c.FormFile("picture")
-	if err == nil && file != nil {
-		// Save the uploaded file
-		filePath := fmt.Sprintf("./uploads/profile_pictures/%d_%s", userID, file.Filename)
-
-		// Make sure folder exists
-		if _, err := os.Stat("./uploads/profile_pictures"); os.IsNotExist(err) {
-			os.MkdirAll("./uploads/profile_pictures", os.ModePerm)
+	// Check uploaded file (optional). Once saved, the picture that is no
+	// longer used is released: the old one, or the new one on failure.
+	oldPicture := user.Picture
+	saved := false
+	defer func() {
+		if user.Picture == oldPicture {
+			return
 		}
-
-		if err := c.SaveFile(file, filePath); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to save profile picture",
-			})
+		if saved {
+			releaseUploads(db, store, oldPicture)
+		} else {
+			releaseUploads(db, store, user.Picture)
 		}
+	}()
 
-		user.Picture = filePath
+	file, err := c.FormFile("picture")
+	if err == nil && file != nil {
+		key, err := storage.SaveImage(store, file, "profile_pictures")
+		if err != nil {
+			return uploadError(c, err)
+		}
+		user.Picture = key
 	}
 
 	// Update username if provided
@@ -150,6 +321,7 @@ func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
 	}
 
 	// Update email if provided
+	emailChanged := false
 	if input.Email != "" && input.Email != user.Email {
 		// Check if email is already taken
 		var existingUser User
@@ -159,6 +331,11 @@ func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
 			})
 		}
 		user.Email = input.Email
+
+		// A new address has to be verified again
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+		emailChanged = true
 	}
 
 	// Update age if provided
@@ -190,6 +367,7 @@ func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
 				"error": "Failed to update expert categories",
 			})
 		}
+
 	}
 
 	// Save updated user
@@ -198,8 +376,16 @@ func UpdateUser(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Failed to update user",
 		})
 	}
+	saved = true
+
+	if emailChanged {
+		if err := sendVerificationEmail(db, mailer, user); err != nil {
+			log.Printf("verification email for user %d: %v", user.ID, err)
+		}
+	}
 
-	return c.JSON(user)
+	db.Preload("ExpertCategories").First(&user, user.ID)
+	return c.JSON(toPrivateUserDTO(user))
 }
 
 func ChangePassword(db *gorm.DB, c *fiber.Ctx) error {
@@ -216,8 +402,8 @@ func ChangePassword(db *gorm.DB, c *fiber.Ctx) error {
 
 	// รับข้อมูลเก่ากับใหม่
 	var input struct {
-		OldPassword string `json:"oldPassword"`
-		NewPassword string `json:"newPassword"`
+		OldPassword string `json:"oldPassword" validate:"required"`
+		NewPassword string `json:"newPassword" validate:"required,min=6,maxbytes=72"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -225,6 +411,9 @@ func ChangePassword(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Invalid input",
 		})
 	}
+	if errs := validation.Struct(&input); errs != nil {
+		return validation.Reply(c, errs)
+	}
 
 	// ตรวจสอบรหัสผ่านเก่า
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.OldPassword)); err != nil {
@@ -249,6 +438,14 @@ func ChangePassword(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	// Log out every other device
+	sessionID, _ := c.Locals("sessionID").(uint)
+	if err := RevokeUserSessions(db, user.ID, sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Password updated but failed to revoke other sessions",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Password updated successfully",
 	})
@@ -266,22 +463,18 @@ func GetCurrentUser(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
-	// Remove sensitive information
-	user.Password = ""
-
-	return c.JSON(user)
+	return c.JSON(toPrivateUserDTO(user))
 }
 
-func LogoutUser(c *fiber.Ctx) error {
-	// Clear the JWT cookie by setting an expired cookie with the same name
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour), // Set expiration to the past
-		HTTPOnly: true,
-		SameSite: "Lax",
-		Secure:   false,
-	})
+func LogoutUser(db *gorm.DB, c *fiber.Ctx) error {
+	// Revoke the session behind the refresh token, if any
+	if refreshToken := c.Cookies("refresh_token"); refreshToken != "" {
+		db.Model(&Session{}).
+			Where("refresh_token_hash = ? AND revoked_at IS NULL", hashToken(refreshToken)).
+			Update("revoked_at", time.Now())
+	}
+
+	clearAuthCookies(c)
 
 	return c.JSON(fiber.Map{
 		"message": "Successfully logged out",
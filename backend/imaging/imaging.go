@@ -0,0 +1,123 @@
+// Package imaging checks uploaded images and re-encodes them into the
+// sizes the site serves. Re-encoding drops EXIF and other metadata, so
+// camera details and GPS positions never reach other users.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("file is not a JPEG, PNG or GIF image")
+	ErrTooLarge        = errors.New("image is too large")
+)
+
+// maxPixels guards against small files that decode into huge images.
+// Decoding takes up to 4 bytes per pixel, plus as much again for the RGBA
+// copy, so this keeps one upload to roughly 100MB; a 12 megapixel phone
+// photo still fits.
+const maxPixels = 13_000_000
+
+// Variant is one served size of an image, bounded by MaxSide pixels
+type Variant struct {
+	Name    string
+	MaxSide int
+}
+
+// Variants are the sizes every uploaded image is stored in
+var Variants = []Variant{
+	{Name: "thumb", MaxSide: 200},
+	{Name: "medium", MaxSide: 800},
+	{Name: "full", MaxSide: 1600},
+}
+
+// largestSide is the MaxSide of the biggest variant
+func largestSide() int {
+	side := 0
+	for _, v := range Variants {
+		if v.MaxSide > side {
+			side = v.MaxSide
+		}
+	}
+	return side
+}
+
+// Result is a processed image: one encoded file per variant, all with the
+// same extension and content type
+type Result struct {
+	Ext         string
+	ContentType string
+	Files       map[string][]byte
+}
+
+// Process sniffs data for a supported image type, enforces maxBytes,
+// applies the EXIF orientation and encodes every variant
+func Process(data []byte, maxBytes int64) (*Result, error) {
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	var decode func([]byte) (image.Image, error)
+	switch contentType {
+	case "image/jpeg":
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+	case "image/png":
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+	case "image/gif":
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+	default:
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+
+	// Scale down to the largest variant before turning the image upright,
+	// so only the first copy is full size
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	src = fit(src, largestSide())
+	if contentType == "image/jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+
+	// JPEGs stay JPEG; PNG and GIF keep their transparency as PNG
+	result := &Result{Ext: ".png", ContentType: "image/png", Files: map[string][]byte{}}
+	if contentType == "image/jpeg" {
+		result.Ext, result.ContentType = ".jpg", "image/jpeg"
+	}
+
+	for _, v := range Variants {
+		var buf bytes.Buffer
+		resized := fit(src, v.MaxSide)
+		if result.ContentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Files[v.Name] = buf.Bytes()
+	}
+	return result, nil
+}
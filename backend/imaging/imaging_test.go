@@ -0,0 +1,266 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{255, 0, 0, 255}
+	green = color.RGBA{0, 255, 0, 255}
+	blue  = color.RGBA{0, 0, 255, 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+// grid builds an image from rows of pixels
+func grid(rows ...[]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range row {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestOrient(t *testing.T) {
+	// A B
+	// C D
+	src := grid([]color.RGBA{red, green}, []color.RGBA{blue, white})
+	a, b, c, d := red, green, blue, white
+
+	tests := []struct {
+		orientation int
+		want        [][]color.RGBA
+	}{
+		{1, [][]color.RGBA{{a, b}, {c, d}}},
+		{2, [][]color.RGBA{{b, a}, {d, c}}}, // mirrored
+		{3, [][]color.RGBA{{d, c}, {b, a}}}, // rotated 180
+		{4, [][]color.RGBA{{c, d}, {a, b}}}, // flipped
+		{5, [][]color.RGBA{{a, c}, {b, d}}}, // transposed
+		{6, [][]color.RGBA{{c, a}, {d, b}}}, // rotated 90 clockwise
+		{7, [][]color.RGBA{{d, b}, {c, a}}}, // transversed
+		{8, [][]color.RGBA{{b, d}, {a, c}}}, // rotated 90 counter-clockwise
+	}
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		for y, row := range tt.want {
+			for x, want := range row {
+				if c := got.RGBAAt(x, y); c != want {
+					t.Errorf("orientation %d: pixel (%d,%d) = %v, want %v", tt.orientation, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestOrientSwapsSides(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for o := 1; o <= 8; o++ {
+		got := orient(src, o).Bounds()
+		w, h := 3, 2
+		if o >= 5 {
+			w, h = 2, 3
+		}
+		if got.Dx() != w || got.Dy() != h {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", o, got.Dx(), got.Dy(), w, h)
+		}
+	}
+}
+
+// exifSegment is an APP1 segment holding only an orientation tag
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8) // first IFD
+	order.PutUint16(tiff[8:], 1) // one entry
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// withExif inserts an EXIF segment right after the JPEG start marker
+func withExif(jpg, seg []byte) []byte {
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+
+	if o := jpegOrientation(jpg); o != 1 {
+		t.Errorf("no EXIF: got %d, want 1", o)
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, want := range []int{3, 6, 8} {
+			if o := jpegOrientation(withExif(jpg, exifSegment(order, uint16(want)))); o != want {
+				t.Errorf("%v: got %d, want %d", order, o, want)
+			}
+		}
+	}
+	if o := jpegOrientation(withExif(jpg, exifSegment(binary.LittleEndian, 42))); o != 1 {
+		t.Errorf("invalid value: got %d, want 1", o)
+	}
+	if o := jpegOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF}); o != 1 {
+		t.Errorf("truncated: got %d, want 1", o)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, maxSide int
+		wantW, wantH  int
+	}{
+		{100, 50, 200, 100, 50}, // already small enough
+		{1000, 500, 200, 200, 100},
+		{500, 1000, 200, 100, 200},
+		{1000, 1000, 800, 800, 800},
+		{3000, 10, 200, 200, 1}, // never below one pixel
+	}
+	for _, tt := range tests {
+		got := fit(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.maxSide).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("fit(%dx%d, %d) = %dx%d, want %dx%d",
+				tt.w, tt.h, tt.maxSide, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestResizeAverages(t *testing.T) {
+	src := grid([]color.RGBA{red, blue}, []color.RGBA{red, blue})
+	c := fit(src, 1).RGBAAt(0, 0)
+	if c.R < 120 || c.R > 135 || c.B < 120 || c.B > 135 || c.G != 0 {
+		t.Errorf("got %v, want an even mix of red and blue", c)
+	}
+}
+
+func decodedSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestProcessVariants(t *testing.T) {
+	result, err := Process(encodePNG(t, image.NewRGBA(image.Rect(0, 0, 2000, 1000))), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ext != ".png" || result.ContentType != "image/png" {
+		t.Errorf("got %s %s, want .png image/png", result.Ext, result.ContentType)
+	}
+	want := map[string][2]int{"thumb": {200, 100}, "medium": {800, 400}, "full": {1600, 800}}
+	for name, size := range want {
+		w, h := decodedSize(t, result.Files[name])
+		if w != size[0] || h != size[1] {
+			t.Errorf("%s: %dx%d, want %dx%d", name, w, h, size[0], size[1])
+		}
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	// Left half red, right half blue; orientation 6 turns it upright with
+	// red on top
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := red
+			if x >= 200 {
+				c = blue
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	data := withExif(encodeJPEG(t, src), exifSegment(binary.BigEndian, 6))
+
+	result, err := Process(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ContentType != "image/jpeg" {
+		t.Errorf("content type %s, want image/jpeg", result.ContentType)
+	}
+	full, err := jpeg.Decode(bytes.NewReader(result.Files["full"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := full.Bounds(); b.Dx() != 200 || b.Dy() != 400 {
+		t.Fatalf("size %dx%d, want 200x400", b.Dx(), b.Dy())
+	}
+	if r, _, b, _ := full.At(100, 100).RGBA(); r < b {
+		t.Error("top half is not red")
+	}
+	if r, _, b, _ := full.At(100, 300).RGBA(); b < r {
+		t.Error("bottom half is not blue")
+	}
+}
+
+// pngHeader is a PNG that claims the given size; only its header is valid,
+// which is all Process reads before rejecting it
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // RGBA
+
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestProcessLimits(t *testing.T) {
+	if _, err := Process(pngHeader(4000, 4000), 0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("16 megapixels: got %v, want ErrTooLarge", err)
+	}
+	small := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if _, err := Process(small, int64(len(small)-1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("over maxBytes: got %v, want ErrTooLarge", err)
+	}
+	if _, err := Process([]byte("<svg xmlns='http://www.w3.org/2000/svg'/>"), 0); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("SVG: got %v, want ErrUnsupportedType", err)
+	}
+	if _, err := Process([]byte("\x89PNG\r\n\x1a\n garbage"), 0); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("corrupt PNG: got %v, want ErrUnsupportedType", err)
+	}
+}
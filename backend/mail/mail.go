@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dadadun/lifskill/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers outgoing email
+type Sender interface {
+	Send(msg Message) error
+}
+
+// NewSender returns the sender selected by MAIL_DRIVER
+func NewSender() Sender {
+	if config.AppConfig.MailDriver == "smtp" {
+		return &SMTPSender{
+			Host:     config.AppConfig.SMTPHost,
+			Port:     config.AppConfig.SMTPPort,
+			Username: config.AppConfig.SMTPUsername,
+			Password: config.AppConfig.SMTPPassword,
+			From:     config.AppConfig.MailFrom,
+		}
+	}
+	return &LogSender{
+		Path: config.AppConfig.MailLogFile,
+		From: config.AppConfig.MailFrom,
+	}
+}
+
+// SMTPSender sends mail through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(addr, auth, s.From, []string{msg.To}, format(s.From, msg))
+}
+
+// LogSender writes mail to a file, or to the standard log when Path is
+// empty. It is meant for local development and tests.
+type LogSender struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+func (s *LogSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Path == "" {
+		log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\n%s\n", format(s.From, msg), strings.Repeat("-", 72))
+	return err
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
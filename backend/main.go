@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/dadadun/lifskill/config"
 	"github.com/dadadun/lifskill/database"
+	"github.com/dadadun/lifskill/mail"
+	"github.com/dadadun/lifskill/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/golang-jwt/jwt/v4"
@@ -13,67 +21,135 @@ import (
 
 func authRequired(c *fiber.Ctx) error {
 	cookie := c.Cookies("jwt")
-	fmt.Println("JWT cookie received in middleware:", cookie)
 	if cookie == "" {
-		fmt.Println("No JWT cookie found!")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Missing JWT cookie",
 		})
 	}
 
-	// Print the secret key length for debugging
-	fmt.Printf("JWT Secret Key length in middleware: %d bytes\n", len(database.JwtSecretKey))
-
-	token, err := jwt.ParseWithClaims(cookie, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Print the signing method for debugging
-		fmt.Printf("Token signing method: %v\n", token.Method)
-		return database.JwtSecretKey, nil
+	token, err := jwt.ParseWithClaims(cookie, &database.Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return database.JWTKey()
 	})
 
 	if err != nil {
-		fmt.Printf("JWT parse error: %v\n", err)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid token: " + err.Error(),
 		})
 	}
 
 	if !token.Valid {
-		fmt.Println("JWT token is not valid!")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Token is not valid",
 		})
 	}
 
-	claims, ok := token.Claims.(*jwt.StandardClaims)
+	claims, ok := token.Claims.(*database.Claims)
 	if !ok {
-		fmt.Println("JWT claims type assert failed")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid token claims",
 		})
 	}
 
-	fmt.Println("JWT claims subject (userID):", claims.Subject)
+	// Access tokens carry no audience; tokens with one were issued for
+	// something else (email verification, password reset)
+	if claims.Audience != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid token claims",
+		})
+	}
 
 	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
 	if err != nil {
-		fmt.Println("Failed to parse userID from claims:", err)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid userID in token",
 		})
 	}
 
+	// Suspended accounts lose access even with a token that has not expired
+	var user database.User
+	if err := database.DB.Select("id", "suspended", "role").First(&user, userID).Error; err != nil || user.Suspended {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is suspended or no longer exists",
+		})
+	}
+
+	// The session must not have been revoked (logout, password change, ...)
+	if !database.IsSessionActive(database.DB, claims.Id, uint(userID)) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has been revoked",
+		})
+	}
+	sessionID, _ := strconv.ParseUint(claims.Id, 10, 64)
+
+	// The role comes from the account, not the token, so role changes
+	// apply at once and a token's claims grant nothing by themselves
+	role := user.Role
+	if role == "" {
+		role = database.RoleMember
+	}
+
 	c.Locals("userID", uint(userID))
-	fmt.Println("userID saved in Locals:", userID)
+	c.Locals("role", role)
+	c.Locals("sessionID", uint(sessionID))
 	return c.Next()
 }
 
-func main() {
-	app := fiber.New()
+// roleRequired must run after authRequired; it only lets through users
+// whose role is one of the given roles
+func roleRequired(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, r := range roles {
+			if role == r {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You do not have permission to perform this action",
+		})
+	}
+}
 
+func main() {
 	// Load configuration
 	config.LoadConfig()
+	if err := database.SetJWTSecret(config.AppConfig.JWTSecret); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	// Posts can carry several attachments, so the body limit covers the
+	// whole form; each file is checked against its own limit
+	app := fiber.New(fiber.Config{
+		BodyLimit: config.AppConfig.MaxRequestMB << 20,
+	})
+
 	database.ConnectDatabase()
+	mailer := mail.NewSender()
+	store, err := storage.New()
+	if err != nil {
+		log.Fatalf("Failed to set up media storage: %v", err)
+	}
+	// Background jobs run until the server is asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		app.Shutdown()
+	}()
+	database.StartRankingJob(ctx, database.DB, time.Duration(config.AppConfig.RankingIntervalMinutes)*time.Minute)
+	database.StartSearchWordsJob(ctx, database.DB, time.Duration(config.AppConfig.SearchWordsIntervalMinutes)*time.Minute)
+
+	setupRoutes(app, mailer, store)
+
+	// Start server with configured port
+	app.Listen(":" + config.AppConfig.Port)
+}
 
+// setupRoutes registers middleware and every route on app
+func setupRoutes(app *fiber.App, mailer mail.Sender, store storage.Storage) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     config.AppConfig.FrontendURL,
 		AllowHeaders:     "Origin, Content-Type, Accept",
@@ -84,8 +160,15 @@ func main() {
 
 	app.Static("/", "../frontend/lifskill_frontend/dist")
 
-	// Serve uploaded images
-	app.Static("/uploads", config.AppConfig.UploadDir)
+	// Serve uploaded images. Stored pictures are referenced by their
+	// key under /uploads, so remote backends are reached via a redirect.
+	if local, ok := store.(*storage.LocalStorage); ok {
+		app.Static("/uploads", local.Dir)
+	} else {
+		app.Get("/uploads/*", func(c *fiber.Ctx) error {
+			return c.Redirect(store.URL(c.Params("*")), fiber.StatusFound)
+		})
+	}
 
 	fmt.Println("Application started successfully!")
 
@@ -95,59 +178,127 @@ func main() {
 
 	// Public routes
 	app.Post("/register", func(c *fiber.Ctx) error {
-		return database.CreateUser(database.DB, c)
+		return database.CreateUser(database.DB, mailer, c)
 	})
 	app.Post("/login", func(c *fiber.Ctx) error {
 		return database.LoginUser(database.DB, c)
 	})
-	app.Post("/auth/logout", database.LogoutUser)
+	app.Post("/auth/logout", func(c *fiber.Ctx) error {
+		return database.LogoutUser(database.DB, c)
+	})
+	app.Post("/auth/refresh", func(c *fiber.Ctx) error {
+		return database.RefreshSession(database.DB, c)
+	})
+	app.Post("/auth/verify_email", database.VerifyEmail(database.DB))
+	app.Post("/auth/password_reset/request", database.RequestPasswordReset(database.DB, mailer))
+	app.Post("/auth/password_reset", database.ResetPassword(database.DB))
 
 	app.Get("/get_all_post", database.GetAllPosts(database.DB))
 	app.Get("/get_post_by_id/:id", database.GetPostByID(database.DB))
 	app.Get("/post/:id", database.GetPostDetails(database.DB))
 	app.Get("/search_post", database.SearchPosts(database.DB))
+	app.Get("/search/suggest", database.SuggestSearch(database.DB))
 	app.Get("/comments/:post_id", database.GetCommentsByPostID(database.DB))
 	app.Get("/filter_posts", database.FilterPosts(database.DB))
+	app.Get("/filter_posts/faceted", database.FacetedFilterPosts(database.DB))
 	app.Get("/approved_posts", database.GetApprovedPosts(database.DB))
 	app.Get("/recommend_posts_by_age", database.RecommendPostsByAge(database.DB))
+	app.Get("/request_posts", database.GetRequestPosts(database.DB))
+	app.Get("/request_posts/:id", database.GetRequestPostByID(database.DB))
 
 	// New public route to get all categories
 	app.Get("/categories", database.GetAllCategories(database.DB))
+	app.Get("/categories/:id/levels", database.GetCategoryLevels(database.DB))
+	app.Get("/users/:username", database.GetPublicProfile(database.DB))
+	app.Get("/users/:username/badges", database.GetUserBadges(database.DB))
+	app.Get("/users/:username/followers", database.GetFollowers(database.DB))
+	app.Get("/users/:username/following", database.GetFollowing(database.DB))
+	app.Get("/leaderboard", database.GetGlobalLeaderboard(database.DB))
+	app.Get("/leaderboard/categories/:id", database.GetCategoryLeaderboard(database.DB))
 
 	// Auth-protected group
 	auth := app.Group("/", authRequired)
 
-	auth.Post("/category", func(c *fiber.Ctx) error {
+	auth.Post("/category", roleRequired(database.RoleModerator, database.RoleAdmin), func(c *fiber.Ctx) error {
 		return database.CreateCategory(database.DB, c)
 	})
 
 	auth.Post("/create_post", func(c *fiber.Ctx) error {
-		return database.CreatePost(database.DB, c)
+		return database.CreatePost(database.DB, store, c)
 	})
 
 	// New post-related endpoints
 	auth.Post("/post/:id/comment", database.AddComment(database.DB))
 	auth.Put("/post/:id/bookmark", database.ToggleBookmark(database.DB))
 	auth.Delete("/delete_posts/:id", database.DeletePost(database.DB))
+	auth.Put("/post/:id", database.UpdatePost(database.DB, store))
+	auth.Get("/post/:id/revisions", database.GetPostRevisions(database.DB))
+	auth.Get("/pending_revisions", database.GetPendingRevisionsForExpert(database.DB))
+	auth.Put("/revisions/:id/review", database.ReviewPostRevision(database.DB))
 
 	auth.Put("/like_post/:id", database.LikePost(database.DB))
 	auth.Get("/my-posts", database.GetMyPosts(database.DB))
 	auth.Post("/create_comments", database.CreateComment(database.DB))
 	auth.Put("/user/update", func(c *fiber.Ctx) error {
-		return database.UpdateUser(database.DB, c)
+		return database.UpdateUser(database.DB, mailer, store, c)
 	})
 	auth.Put("/user/change-password", func(c *fiber.Ctx) error {
 		return database.ChangePassword(database.DB, c)
 	})
+	auth.Put("/user/privacy", database.UpdatePrivacySettings(database.DB))
+	auth.Post("/users/:username/follow", database.FollowUser(database.DB))
+	auth.Delete("/users/:username/follow", database.UnfollowUser(database.DB))
 	auth.Get("/user/me", func(c *fiber.Ctx) error {
 		return database.GetCurrentUser(database.DB, c)
 	})
+	auth.Post("/auth/verify_email/request", database.RequestEmailVerification(database.DB, mailer))
+	auth.Get("/auth/sessions", database.GetMySessions(database.DB))
+	auth.Delete("/auth/sessions/:id", database.RevokeSession(database.DB))
+	auth.Post("/auth/logout_all", database.LogoutAllSessions(database.DB))
 	auth.Put("/approve_post/:id", database.ApprovePost(database.DB))
+	auth.Put("/reject_post/:id", database.RejectPost(database.DB))
+	auth.Get("/my-posts/:id/reviews", database.GetPostReviews(database.DB))
 	auth.Get("/request_post", database.GetPendingPostsForExpert(database.DB))
 	auth.Post("/achieve_post/:id", database.AchievePost(database.DB))
+	auth.Post("/post/:id/progress", database.StartPostProgress(database.DB))
+	auth.Get("/post/:id/progress", database.GetPostProgress(database.DB))
+	auth.Put("/post/:id/steps/:step_id/progress", database.SetStepCompleted(database.DB))
+	auth.Get("/my_progress", database.GetMyProgress(database.DB))
+	auth.Get("/feed", database.GetFeed(database.DB))
+	auth.Post("/feed/seen", database.MarkFeedSeen(database.DB))
 	auth.Get("/my_achievements", database.GetMyAchievements(database.DB))
 	auth.Get("/my_achieved_posts", database.GetMyAchievedPosts(database.DB))
+	auth.Get("/my_badges", database.GetMyBadges(database.DB))
+	auth.Get("/my_levels", database.GetMyLevels(database.DB))
 
-	// Start server with configured port
-	app.Listen(":" + config.AppConfig.Port)
+	// Request post ("ask an expert") routes
+	auth.Post("/request_posts", func(c *fiber.Ctx) error {
+		return database.CreateRequestPost(database.DB, store, c)
+	})
+	auth.Put("/request_posts/:id/approve", database.ApproveRequestPost(database.DB))
+	auth.Put("/request_posts/:id/fulfill", database.FulfillRequestPost(database.DB))
+
+	auth.Get("/notifications", database.GetMyNotifications(database.DB))
+	auth.Put("/notifications/:id/read", database.MarkNotificationRead(database.DB))
+
+	// Moderation routes
+	moderation := auth.Group("/moderation", roleRequired(database.RoleModerator, database.RoleAdmin))
+	moderation.Put("/posts/:id/takedown", database.TakeDownPost(database.DB))
+	moderation.Put("/users/:id/suspend", database.SetUserSuspended(database.DB, true))
+	moderation.Put("/users/:id/unsuspend", database.SetUserSuspended(database.DB, false))
+
+	// Admin routes
+	admin := auth.Group("/admin", roleRequired(database.RoleAdmin))
+	admin.Get("/users", database.AdminListUsers(database.DB))
+	admin.Put("/users/:id/role", database.SetUserRole(database.DB))
+	admin.Put("/users/:id/suspend", database.SetUserSuspended(database.DB, true))
+	admin.Put("/users/:id/unsuspend", database.SetUserSuspended(database.DB, false))
+	admin.Delete("/users/:id", database.AdminDeleteUser(database.DB))
+	admin.Put("/posts/:id/approve", database.AdminSetPostStatus(database.DB, "approved"))
+	admin.Put("/posts/:id/reject", database.AdminSetPostStatus(database.DB, "rejected"))
+	admin.Put("/categories/:id", database.AdminRenameCategory(database.DB))
+	admin.Put("/categories/:id/policy", database.AdminUpdateCategoryPolicy(database.DB))
+	admin.Put("/categories/:id/levels", database.AdminUpdateCategoryLevels(database.DB))
+	admin.Post("/categories/:id/merge", database.AdminMergeCategory(database.DB))
+	admin.Delete("/categories/:id", database.AdminDeleteCategory(database.DB))
 }
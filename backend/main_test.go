@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dadadun/lifskill/config"
+	"github.com/dadadun/lifskill/database"
+	"github.com/dadadun/lifskill/mail"
+	"github.com/dadadun/lifskill/storage"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// leakFixture is the data seeded for TestNoRouteLeaksCredentials
+type leakFixture struct {
+	users    map[string]*database.User // by username
+	tokens   map[string]string         // access token by username
+	category database.Category
+	post     database.Post
+}
+
+// seedLeakFixture creates an admin, a member and an author whose content
+// shows up in most responses. Names carry a suffix so reruns don't clash.
+func seedLeakFixture(t *testing.T, app *fiber.App) *leakFixture {
+	t.Helper()
+	db := database.DB
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	f := &leakFixture{users: map[string]*database.User{}, tokens: map[string]string{}}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []string{database.RoleAdmin, database.RoleMember, database.RoleExpert} {
+		user := &database.User{
+			Username:      role + "_" + suffix,
+			Password:      string(hash),
+			Email:         role + "_" + suffix + "@example.com",
+			Age:           30,
+			Role:          role,
+			EmailVerified: true,
+			ShowAge:       true,
+		}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+		f.users[role] = user
+	}
+	author := f.users[database.RoleExpert]
+
+	f.category = database.Category{CategoriesName: "leaks_" + suffix}
+	if err := db.Create(&f.category).Error; err != nil {
+		t.Fatalf("seed category: %v", err)
+	}
+	db.Model(author).Association("ExpertCategories").Append(&f.category)
+
+	f.post = database.Post{
+		Title:             "Tying knots " + suffix,
+		Content:           "Start with a loop",
+		RecommendAgeRange: "10-40",
+		Status:            "approved",
+		UserID:            author.ID,
+		Categories:        []database.Category{f.category},
+	}
+	if err := db.Create(&f.post).Error; err != nil {
+		t.Fatalf("seed post: %v", err)
+	}
+	pending := database.Post{
+		Title: "Pending " + suffix, Content: "Awaiting review", Status: "pending",
+		UserID: author.ID, Categories: []database.Category{f.category},
+	}
+	db.Create(&pending)
+	db.Create(&database.Comment{CommentContent: "Nice", UserID: author.ID, PostID: f.post.ID})
+	db.Create(&database.RequestPost{
+		Title: "How to sail " + suffix, Content: "Please", UserID: author.ID,
+		Categories: []database.Category{f.category},
+	})
+	db.Create(&database.Follow{FollowerID: author.ID, FolloweeID: f.users[database.RoleMember].ID, CreatedAt: time.Now()})
+	db.Create(&database.Follow{FollowerID: f.users[database.RoleMember].ID, FolloweeID: author.ID, CreatedAt: time.Now()})
+	db.Create(&database.AchievementEvent{
+		UserID: author.ID, CategoryID: f.category.ID, PostID: &f.post.ID,
+		Source: database.SourcePostCompleted, Points: 5, CreatedAt: time.Now(),
+	})
+
+	for _, user := range f.users {
+		f.tokens[user.Username] = login(t, app, user.Email, "secret123")
+	}
+	return f
+}
+
+// login signs in through the real route and returns the access token
+func login(t *testing.T, app *fiber.App, email, password string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(fmt.Sprintf(`{"email":%q,"password":%q}`, email, password)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "jwt" {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("login %s: no jwt cookie (status %d)", email, resp.StatusCode)
+	return ""
+}
+
+// routePath fills route parameters with IDs from the fixture
+func (f *leakFixture) routePath(path string) string {
+	author := f.users[database.RoleExpert]
+	id := strconv.FormatUint(uint64(f.post.ID), 10)
+	switch {
+	case strings.Contains(path, "/users/:id"):
+		id = strconv.FormatUint(uint64(author.ID), 10)
+	case strings.Contains(path, "/categories/:id"):
+		id = strconv.FormatUint(uint64(f.category.ID), 10)
+	}
+	replacer := strings.NewReplacer(
+		":username", author.Username,
+		":post_id", strconv.FormatUint(uint64(f.post.ID), 10),
+		":step_id", "1",
+		":id", id,
+		"*", "missing.png",
+	)
+	return replacer.Replace(path)
+}
+
+// routeOrder runs reads first and anything that logs out or deletes last,
+// so every route still sees the seeded data and a valid session
+func routeOrder(route fiber.Route) int {
+	switch {
+	case strings.Contains(route.Path, "/auth/"):
+		return 3
+	case route.Method == http.MethodDelete:
+		return 2
+	case route.Method == http.MethodGet:
+		return 0
+	}
+	return 1
+}
+
+// Every route is called anonymously and as each seeded user. No response
+// may contain any password hash, or the email of a user other than the
+// caller; the only exception is the admin user list, shown to admins.
+func TestNoRouteLeaksCredentials(t *testing.T) {
+	dbName := os.Getenv("TEST_DB_NAME")
+	if dbName == "" {
+		t.Skip("set TEST_DB_NAME (and DB_HOST, DB_USER, ... as needed) to run against a Postgres test database")
+	}
+	config.LoadConfig()
+	config.AppConfig.DBName = dbName
+	if err := database.SetJWTSecret("leak-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	database.ConnectDatabase()
+
+	app := fiber.New()
+	setupRoutes(app, &mail.LogSender{Path: os.DevNull}, storage.NewLocal(t.TempDir(), "/uploads"))
+	f := seedLeakFixture(t, app)
+
+	var hashes []string
+	database.DB.Model(&database.User{}).Pluck("password", &hashes)
+
+	var routes []fiber.Route
+	seen := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == http.MethodHead || route.Method == http.MethodOptions || seen[route.Method+route.Path] {
+			continue
+		}
+		seen[route.Method+route.Path] = true
+		routes = append(routes, route)
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routeOrder(routes[i]) < routeOrder(routes[j]) })
+
+	callers := []*database.User{nil, f.users[database.RoleMember], f.users[database.RoleExpert], f.users[database.RoleAdmin]}
+	mentionsAuthor := false
+	for _, route := range routes {
+		for _, caller := range callers {
+			name := "anonymous"
+			if caller != nil {
+				name = caller.Username
+			}
+			req := httptest.NewRequest(route.Method, f.routePath(route.Path), strings.NewReader("{}"))
+			req.Header.Set("Content-Type", "application/json")
+			if caller != nil {
+				req.Header.Set("Cookie", "jwt="+f.tokens[caller.Username])
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("%s %s as %s: %v", route.Method, route.Path, name, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			text := string(body)
+
+			for _, hash := range hashes {
+				if hash != "" && strings.Contains(text, hash) {
+					t.Errorf("%s %s as %s: response contains a password hash", route.Method, route.Path, name)
+				}
+			}
+			adminList := route.Path == "/admin/users" && caller != nil && caller.Role == database.RoleAdmin
+			for _, user := range f.users {
+				if user != caller && !adminList && strings.Contains(text, user.Email) {
+					t.Errorf("%s %s as %s: response contains %s's email", route.Method, route.Path, name, user.Username)
+				}
+			}
+			if strings.Contains(text, f.users[database.RoleExpert].Username) {
+				mentionsAuthor = true
+			}
+		}
+	}
+
+	// Guard against a fixture that no route ever returns
+	if !mentionsAuthor {
+		t.Fatal("no response mentioned the seeded author; the fixture is not being exercised")
+	}
+}
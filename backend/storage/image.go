@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+
+	"github.com/dadadun/lifskill/config"
+	"github.com/dadadun/lifskill/imaging"
+)
+
+// SaveImage checks and resizes an uploaded image, stores every variant
+// and returns the key of the full-size one, e.g.
+// "posts/3f/3f2a...c1_full.jpg". The other variants sit next to it and
+// are found with VariantKey.
+func SaveImage(s Storage, file *multipart.FileHeader, prefix string) (string, error) {
+	maxBytes := int64(config.AppConfig.MaxUploadMB) << 20
+	if maxBytes > 0 && file.Size > maxBytes {
+		return "", imaging.ErrTooLarge
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	img, err := imaging.Process(data, maxBytes)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	base := path.Join(prefix, hash[:2], hash)
+	for _, v := range imaging.Variants {
+		if err := s.Put(base+"_"+v.Name+img.Ext, img.Files[v.Name], img.ContentType); err != nil {
+			return "", err
+		}
+	}
+	return base + "_full" + img.Ext, nil
+}
+
+// VariantKey returns the key of another size of the image stored under
+// key. Files stored before resizing existed only have one size.
+func VariantKey(key, variant string) string {
+	ext := path.Ext(key)
+	stem := strings.TrimSuffix(key, ext)
+	if !strings.HasSuffix(stem, "_full") {
+		return key
+	}
+	return strings.TrimSuffix(stem, "_full") + "_" + variant + ext
+}
+
+// DeleteImage removes an image stored by SaveImage with all its variants,
+// or a single object for any other key. Keys are shared by identical
+// uploads, so callers must make sure nothing else uses the key.
+func DeleteImage(s Storage, key string) error {
+	keys := []string{key}
+	if VariantKey(key, "thumb") != key {
+		keys = keys[:0]
+		for _, v := range imaging.Variants {
+			keys = append(keys, VariantKey(key, v.Name))
+		}
+	}
+	for _, k := range keys {
+		if err := s.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImageURLs are the public URLs of each size of an image
+type ImageURLs struct {
+	Thumb  string `json:"thumb"`
+	Medium string `json:"medium"`
+	Full   string `json:"full"`
+}
+
+// ImageURLsFor builds the URLs of an image saved by SaveImage. It also
+// accepts older values that were stored as a path under ./uploads.
+func ImageURLsFor(key string) *ImageURLs {
+	if key == "" {
+		return nil
+	}
+	if strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") {
+		return &ImageURLs{Thumb: key, Medium: key, Full: key}
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "./"), "uploads/")
+
+	return &ImageURLs{
+		Thumb:  URL(VariantKey(key, "thumb")),
+		Medium: URL(VariantKey(key, "medium")),
+		Full:   URL(key),
+	}
+}
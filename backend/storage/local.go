@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalStorage keeps objects on disk under Dir and serves them from
+// BaseURL (see app.Static in main.go)
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+func NewLocal(dir, baseURL string) *LocalStorage {
+	return &LocalStorage{Dir: dir, BaseURL: baseURL}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *LocalStorage) Put(key string, data []byte, contentType string) error {
+	dst := s.path(key)
+	// Keys are content hashes, so an existing file already has this content
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a half-written upload is never served
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStoragePutDelete(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocal(dir, "/uploads")
+
+	key := Key("attachments", []byte("pdf"), ".PDF")
+	if filepath.Ext(key) != ".pdf" {
+		t.Fatalf("key %q should have a lower-case extension", key)
+	}
+	if err := s.Put(key, []byte("pdf"), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(key))); err != nil || string(data) != "pdf" {
+		t.Fatalf("stored file: %q, %v", data, err)
+	}
+	if got := s.URL(key); got != "/uploads/"+key {
+		t.Errorf("URL = %q", got)
+	}
+
+	if err := s.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(key); err != nil {
+		t.Fatalf("deleting a missing key should succeed, got %v", err)
+	}
+
+	// Keys can't climb out of the upload directory
+	if err := s.Put("../../escape.txt", []byte("x"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err != nil {
+		t.Fatalf("expected the file inside the upload dir: %v", err)
+	}
+}
+
+func TestDeleteImageRemovesVariants(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocal(dir, "/uploads")
+	for _, variant := range []string{"thumb", "medium", "full"} {
+		if err := s.Put("posts/ab/ab_"+variant+".png", []byte(variant), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("posts/ab/other.png", []byte("other"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteImage(s, "posts/ab/ab_full.png"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "posts", "ab"))
+	if len(entries) != 1 || entries[0].Name() != "other.png" {
+		t.Fatalf("expected only other.png to remain, got %v", entries)
+	}
+}
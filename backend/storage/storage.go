@@ -0,0 +1,81 @@
+// Package storage saves uploaded media under content-addressed keys, so the
+// same file is only stored once and different files never collide.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/dadadun/lifskill/config"
+)
+
+// Storage is a backend that holds uploaded objects
+type Storage interface {
+	// Put stores data under key; storing the same key twice is harmless
+	Put(key string, data []byte, contentType string) error
+	// Delete removes the object stored under key
+	Delete(key string) error
+	// URL is where clients can fetch the object stored under key
+	URL(key string) string
+}
+
+// Default is the backend created by New, used to build public URLs
+var Default Storage
+
+// New returns the backend selected by STORAGE_DRIVER and makes it the
+// Default
+func New() (Storage, error) {
+	var (
+		s   Storage
+		err error
+	)
+	switch config.AppConfig.StorageDriver {
+	case "", "local":
+		s = NewLocal(config.AppConfig.UploadDir, "/uploads")
+	case "s3":
+		s, err = NewS3(S3Config{
+			Endpoint:  config.AppConfig.S3Endpoint,
+			Region:    config.AppConfig.S3Region,
+			Bucket:    config.AppConfig.S3Bucket,
+			AccessKey: config.AppConfig.S3AccessKey,
+			SecretKey: config.AppConfig.S3SecretKey,
+			PublicURL: config.AppConfig.S3PublicURL,
+		})
+	default:
+		err = fmt.Errorf("unknown storage driver %q", config.AppConfig.StorageDriver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	Default = s
+	return s, nil
+}
+
+// URL is the public URL of key on the Default backend
+func URL(key string) string {
+	if Default == nil {
+		return "/uploads/" + key
+	}
+	return Default.URL(key)
+}
+
+// Key builds the content-addressed key for data, e.g.
+// "posts/3f/3f2a...c1.jpg"
+func Key(prefix string, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return path.Join(prefix, hash[:2], hash+strings.ToLower(ext))
+}
+
+// SaveBytes stores data under prefix and returns its key
+func SaveBytes(s Storage, data []byte, prefix, ext string) (string, error) {
+	key := Key(prefix, data, ext)
+	if err := s.Put(key, data, http.DetectContentType(data)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
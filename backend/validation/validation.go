@@ -0,0 +1,261 @@
+// Package validation checks request structs against declarative rules in
+// `validate` struct tags, e.g.
+//
+//	Title string `json:"title" validate:"required,max=150"`
+//
+// Rules are comma separated and applied in order. Supported rules:
+//
+//	required   non-blank string, non-zero number, non-empty slice
+//	omitempty  skip the remaining rules when the value is empty
+//	min=N      minimum string length (in characters), number or slice length
+//	max=N      maximum string length (in characters), number or slice length
+//	maxbytes=N maximum string length in UTF-8 bytes, e.g. bcrypt's 72
+//	email      looks like an email address
+//	url        absolute http(s) URL
+//	agerange   "min-max" age range such as "10-15"
+//	oneof=a b  one of the space separated values
+//	dive       validate each struct in a slice by its own tags
+//
+// A nil pointer means an optional field was not sent and is skipped; other
+// pointers are validated through, so "required" then means "not blank".
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Struct validates v, which must be a struct or a pointer to one, and
+// returns nil when every rule passes
+func Struct(v interface{}) Errors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+		name := fieldName(field)
+		if msg := check(rv.Field(i), tag); msg != "" {
+			errs = append(errs, FieldError{Field: name, Message: msg})
+			continue
+		}
+		if hasRule(tag, "dive") {
+			errs = append(errs, dive(rv.Field(i), name)...)
+		}
+	}
+	return errs
+}
+
+// dive validates every element of a slice of structs, naming fields like
+// "steps[2].text"
+func dive(v reflect.Value, name string) Errors {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+
+	var errs Errors
+	for i := 0; i < v.Len(); i++ {
+		for _, fe := range Struct(v.Index(i).Interface()) {
+			fe.Field = fmt.Sprintf("%s[%d].%s", name, i, fe.Field)
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Reply sends errs as a 422 response with one entry per invalid field
+func Reply(c *fiber.Ctx, errs Errors) error {
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":  "Validation failed",
+		"fields": errs,
+	})
+}
+
+// MaxAge is the highest age accepted in age ranges and filters
+const MaxAge = 150
+
+// ParseAgeRange parses a "min-max" age range with ages up to MaxAge
+func ParseAgeRange(s string) (int, int, bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	minAge, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	maxAge, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || minAge < 0 || maxAge < minAge || maxAge > MaxAge {
+		return 0, 0, false
+	}
+	return minAge, maxAge, true
+}
+
+// fieldName is the name clients know the field by: json tag, then form tag
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		if name := strings.Split(field.Tag.Get(key), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// size is what min and max compare against
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func check(v reflect.Value, tag string) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "omitempty":
+			if isEmpty(v) {
+				return ""
+			}
+		case "required":
+			if isEmpty(v) {
+				return "is required"
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			n, ok := size(v)
+			if err != nil || !ok {
+				continue
+			}
+			if name == "min" && n < limit {
+				return tooSmall(v, param)
+			}
+			if name == "max" && n > limit {
+				return tooLarge(v, param)
+			}
+		case "maxbytes":
+			limit, err := strconv.Atoi(param)
+			if err == nil && v.Kind() == reflect.String && len(v.String()) > limit {
+				return "must be at most " + param + " bytes"
+			}
+		case "email":
+			addr, err := mail.ParseAddress(v.String())
+			if err != nil || addr.Address != v.String() {
+				return "must be a valid email address"
+			}
+		case "url":
+			u, err := url.Parse(v.String())
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return "must be a valid http(s) URL"
+			}
+		case "agerange":
+			if _, _, ok := ParseAgeRange(v.String()); !ok {
+				return "must be an age range like 10-15"
+			}
+		case "oneof":
+			allowed := strings.Fields(param)
+			value := fmt.Sprint(v.Interface())
+			found := false
+			for _, a := range allowed {
+				if value == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "must be one of: " + strings.Join(allowed, ", ")
+			}
+		}
+	}
+	return ""
+}
+
+func tooSmall(v reflect.Value, param string) string {
+	switch v.Kind() {
+	case reflect.String:
+		return "must be at least " + param + " characters"
+	case reflect.Slice, reflect.Map:
+		return "must have at least " + param + " items"
+	}
+	return "must be at least " + param
+}
+
+func tooLarge(v reflect.Value, param string) string {
+	switch v.Kind() {
+	case reflect.String:
+		return "must be at most " + param + " characters"
+	case reflect.Slice, reflect.Map:
+		return "must have at most " + param + " items"
+	}
+	return "must be at most " + param
+}
@@ -0,0 +1,169 @@
+package validation
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type step struct {
+	Text string `json:"text" validate:"required,max=5"`
+}
+
+type request struct {
+	Title    string  `json:"title" validate:"required,max=10"`
+	Nickname *string `json:"nickname" validate:"required,max=5"`
+	Bio      string  `form:"bio" validate:"omitempty,min=3"`
+	Email    string  `json:"email" validate:"omitempty,email"`
+	Link     string  `json:"link" validate:"omitempty,url"`
+	Ages     string  `json:"ages" validate:"omitempty,agerange"`
+	Level    string  `json:"level" validate:"omitempty,oneof=easy hard"`
+	Count    int     `json:"count" validate:"min=1,max=3"`
+	Password string  `json:"password" validate:"omitempty,min=6,maxbytes=72"`
+	Steps    []step  `json:"steps" validate:"max=2,dive"`
+	internal string  `validate:"required"`
+}
+
+func valid() request {
+	return request{Title: "Knots", Count: 1}
+}
+
+func fields(errs Errors) map[string]string {
+	m := map[string]string{}
+	for _, fe := range errs {
+		m[fe.Field] = fe.Message
+	}
+	return m
+}
+
+func TestStructValid(t *testing.T) {
+	nickname := "dan"
+	r := valid()
+	r.Nickname = &nickname
+	r.Bio = "hello"
+	r.Email = "a@example.com"
+	r.Link = "https://example.com/x"
+	r.Ages = "6-12"
+	r.Level = "hard"
+	r.Password = strings.Repeat("a", 72)
+	r.Steps = []step{{Text: "tie"}}
+	if errs := Struct(&r); errs != nil {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if errs := Struct(r); errs != nil {
+		t.Fatalf("non-pointer: expected no errors, got %v", errs)
+	}
+}
+
+func TestStructRules(t *testing.T) {
+	blank := "  "
+	long := "abcdef"
+	tests := []struct {
+		name    string
+		mutate  func(*request)
+		field   string
+		message string
+	}{
+		{"required string", func(r *request) { r.Title = " " }, "title", "is required"},
+		{"max characters", func(r *request) { r.Title = strings.Repeat("ก", 11) }, "title", "must be at most 10 characters"},
+		{"max counts characters not bytes", func(r *request) { r.Title = strings.Repeat("ก", 10) }, "", ""},
+		{"sent pointer must not be blank", func(r *request) { r.Nickname = &blank }, "nickname", "is required"},
+		{"sent pointer is validated through", func(r *request) { r.Nickname = &long }, "nickname", "must be at most 5 characters"},
+		{"form tag names the field", func(r *request) { r.Bio = "hi" }, "bio", "must be at least 3 characters"},
+		{"email", func(r *request) { r.Email = "Dan <a@example.com>" }, "email", "must be a valid email address"},
+		{"url scheme", func(r *request) { r.Link = "javascript:alert(1)" }, "link", "must be a valid http(s) URL"},
+		{"agerange", func(r *request) { r.Ages = "12-6" }, "ages", "must be an age range like 10-15"},
+		{"oneof", func(r *request) { r.Level = "medium" }, "level", "must be one of: easy, hard"},
+		{"min number", func(r *request) { r.Count = 0 }, "count", "must be at least 1"},
+		{"max number", func(r *request) { r.Count = 4 }, "count", "must be at most 3"},
+		{"maxbytes", func(r *request) { r.Password = strings.Repeat("ก", 25) }, "password", "must be at most 72 bytes"},
+		{"max items", func(r *request) { r.Steps = []step{{"a"}, {"b"}, {"c"}} }, "steps", "must have at most 2 items"},
+		{"dive", func(r *request) { r.Steps = []step{{"a"}, {""}} }, "steps[1].text", "is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.mutate(&r)
+			got := fields(Struct(&r))
+			if tt.field == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected no errors, got %v", got)
+				}
+				return
+			}
+			if got[tt.field] != tt.message {
+				t.Fatalf("field %q: got %q, want %q (all: %v)", tt.field, got[tt.field], tt.message, got)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected only %q to fail, got %v", tt.field, got)
+			}
+		})
+	}
+}
+
+func TestStructReportsEveryField(t *testing.T) {
+	r := request{Count: 9}
+	got := fields(Struct(&r))
+	if len(got) != 2 || got["title"] == "" || got["count"] == "" {
+		t.Fatalf("expected title and count errors, got %v", got)
+	}
+}
+
+func TestStructIgnoresNonStructs(t *testing.T) {
+	if errs := Struct("title"); errs != nil {
+		t.Fatalf("expected nil, got %v", errs)
+	}
+}
+
+func TestParseAgeRange(t *testing.T) {
+	tests := []struct {
+		in       string
+		min, max int
+		ok       bool
+	}{
+		{"10-15", 10, 15, true},
+		{" 0 - 99 ", 0, 99, true},
+		{"7-7", 7, 7, true},
+		{"0-150", 0, 150, true},
+		{"10-151", 0, 0, false},
+		{"0-3000000000", 0, 0, false},
+		{"15-10", 0, 0, false},
+		{"-1-5", 0, 0, false},
+		{"18+", 0, 0, false},
+		{"1-2-3", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		min, max, ok := ParseAgeRange(tt.in)
+		if ok != tt.ok || min != tt.min || max != tt.max {
+			t.Errorf("ParseAgeRange(%q) = %d, %d, %v; want %d, %d, %v", tt.in, min, max, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return Reply(c, Errors{{Field: "title", Message: "is required"}})
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", resp.StatusCode)
+	}
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "Validation failed" || len(body.Fields) != 1 || body.Fields[0].Field != "title" {
+		t.Fatalf("unexpected body %+v", body)
+	}
+}
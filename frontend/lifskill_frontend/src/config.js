@@ -6,9 +6,42 @@ export const getApiUrl = (path) => {
   return `${API_URL}${path}`;
 };
 
-// Helper function to get image URL
-export const getImageUrl = (path) => {
+// Helper function to get image URL. Pictures from the API are objects
+// with thumb, medium and full URLs; pick the size to show.
+export const getImageUrl = (picture, size = 'medium') => {
+  const path = picture && typeof picture === 'object' ? picture[size] || picture.full : picture;
   if (!path) return '/default-avatar.png';
   if (path.startsWith('http')) return path;
-  return `${API_URL}/${path}`;
-}; 
\ No newline at end of file
+  return path.startsWith('/') ? `${API_URL}${path}` : `${API_URL}/${path}`;
+}; 
+// Access tokens are short-lived: when an API call comes back 401, ask the
+// backend to rotate the refresh token and retry the call once. Calls that
+// fail together share one refresh, since every refresh rotates the token.
+export const installAuthRefresh = () => {
+  const originalFetch = window.fetch.bind(window);
+  let refreshing = null;
+  const refresh = () => {
+    if (!refreshing) {
+      refreshing = originalFetch(getApiUrl('/auth/refresh'), {
+        method: 'POST',
+        credentials: 'include',
+      })
+        .then((response) => response.ok)
+        .catch(() => false)
+        .finally(() => {
+          refreshing = null;
+        });
+    }
+    return refreshing;
+  };
+
+  window.fetch = async (input, init) => {
+    const response = await originalFetch(input, init);
+    const url = typeof input === 'string' ? input : input.url;
+    if (response.status !== 401 || !url.startsWith(API_URL) || url.includes('/auth/')) {
+      return response;
+    }
+    if (!(await refresh())) return response;
+    return originalFetch(input, init);
+  };
+};
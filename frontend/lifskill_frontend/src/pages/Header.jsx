@@ -11,6 +11,7 @@ function Header({ onPostCreated }) {
   const navigate = useNavigate();
   const [isCreateModalOpen, setIsCreateModalOpen] = useState(false);
   const [searchQuery, setSearchQuery] = useState('');
+  const [suggestions, setSuggestions] = useState(null);
   
   // States for create post form
   const [postTitle, setPostTitle] = useState('');
@@ -218,14 +219,52 @@ const handleCreatePost = async () => {
 };
 
 
+  // Fetch search suggestions while typing
+  useEffect(() => {
+    const q = searchQuery.trim();
+    if (q.length < 2) {
+      setSuggestions(null);
+      return;
+    }
+    const controller = new AbortController();
+    const timer = setTimeout(async () => {
+      try {
+        const response = await fetch(getApiUrl(`/search/suggest?q=${encodeURIComponent(q)}`), {
+          signal: controller.signal,
+        });
+        if (response.ok) {
+          setSuggestions(await response.json());
+        }
+      } catch (error) {
+        if (error.name !== 'AbortError') {
+          console.error('Error fetching suggestions:', error);
+        }
+      }
+    }, 200);
+    return () => {
+      clearTimeout(timer);
+      controller.abort();
+    };
+  }, [searchQuery]);
+
   // Handle search
   const handleSearch = (e) => {
     e.preventDefault();
     if (searchQuery.trim()) {
+      setSuggestions(null);
       navigate(`/search?q=${encodeURIComponent(searchQuery.trim())}`);
     }
   };
 
+  const goToSuggestion = (path) => {
+    setSuggestions(null);
+    navigate(path);
+  };
+
+  const hasSuggestions = suggestions && (
+    suggestions.posts.length > 0 || suggestions.categories.length > 0
+  );
+
   // Handle modal close
   const handleModalClose = () => {
     resetForm();
@@ -252,13 +291,14 @@ const handleCreatePost = async () => {
         </div>
         
         {/* Search Bar */}
-        <form onSubmit={handleSearch} className="flex items-center w-full md:max-w-[600px] px-3 py-1">
+        <form onSubmit={handleSearch} className="relative flex items-center w-full md:max-w-[600px] px-3 py-1">
           <input
             type="text"
             placeholder="Search what content you want..."
             className="flex-1 text-sm text-black shadow-sm rounded-l-full px-3 py-2 bg-white border border-gray-200 focus:border-blue-500 focus:ring-1 focus:ring-blue-500 outline-none"
             value={searchQuery}
             onChange={(e) => setSearchQuery(e.target.value)}
+            onBlur={() => setTimeout(() => setSuggestions(null), 150)}
           />
           <button 
             type="submit"
@@ -274,6 +314,33 @@ const handleCreatePost = async () => {
               }}
             />
           </button>
+
+          {/* Search Suggestions */}
+          {hasSuggestions && (
+            <div className="absolute left-3 right-3 top-full mt-1 bg-white border border-gray-200 rounded-xl shadow-lg z-50 py-2 text-sm">
+              {suggestions.posts.map((post) => (
+                <button
+                  key={`post-${post.id}`}
+                  type="button"
+                  onMouseDown={() => goToSuggestion(`/posts/${post.id}`)}
+                  className="block w-full text-left px-4 py-2 text-gray-800 hover:bg-gray-50"
+                >
+                  {post.title}
+                </button>
+              ))}
+              {suggestions.categories.map((category) => (
+                <button
+                  key={`category-${category.id}`}
+                  type="button"
+                  onMouseDown={() => goToSuggestion(`/search?q=${encodeURIComponent(category.categories_name)}`)}
+                  className="block w-full text-left px-4 py-2 text-gray-600 hover:bg-gray-50"
+                >
+                  <span className="text-xs text-gray-400 mr-2">Category</span>
+                  {category.categories_name}
+                </button>
+              ))}
+            </div>
+          )}
         </form>
 
         {/* Login / Profile */}
@@ -312,7 +379,7 @@ const handleCreatePost = async () => {
               >
                 <div className="flex items-center gap-2">
                   <img
-                    src={user.picture ? getImageUrl(user.picture) : "/default-avatar.png"}
+                    src={user.picture ? getImageUrl(user.picture, 'thumb') : "/default-avatar.png"}
                     alt="User Avatar"
                     className="w-6 h-6 rounded-full object-cover"
                     onError={(e) => {
@@ -334,7 +334,7 @@ function Home() {
                       {/* Author Info */}
                       <div className="flex items-center gap-3">
                         <img
-                          src={post.user?.picture ? getImageUrl(post.user.picture) : 'https://via.placeholder.com/32'}
+                          src={post.user?.picture ? getImageUrl(post.user.picture, 'thumb') : 'https://via.placeholder.com/32'}
                           alt={post.user?.username || 'User'}
                           className="w-10 h-10 rounded-full object-cover ring-2 ring-gray-100"
                         />
@@ -389,7 +389,7 @@ function Home() {
                     {post.picture && (
                       <div className="lg:w-80 flex-shrink-0">
                         <img
-                          src={`http://localhost:8080/uploads/${post.picture}`}
+                          src={getImageUrl(post.picture)}
                           alt="Post image"
                           className="w-full h-48 lg:h-40 object-cover rounded-xl group-hover:scale-105 transition-transform duration-300"
                         />
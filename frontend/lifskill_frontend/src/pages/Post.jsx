@@ -16,8 +16,7 @@ const getYouTubeVideoId = (url) => {
 // Helper to get correct user picture URL
 const getUserPictureUrl = (picture) => {
   if (!picture) return 'https://www.gravatar.com/avatar/00000000000000000000000000000000?d=mp&f=y';
-  if (picture.startsWith('http')) return picture;
-  return getImageUrl(picture);
+  return getImageUrl(picture, 'thumb');
 };
 
 const Post = () => {
@@ -125,7 +124,8 @@ const Post = () => {
         credentials: 'include',
       });
       if (!response.ok) throw new Error('Failed to achieve post');
-      setBookmarked(!bookmarked);
+      // Completing a post is one-way; score is only awarded once
+      setBookmarked(true);
     } catch (error) {
       console.error('Error achieving post:', error);
     }
@@ -422,13 +422,101 @@ const Post = () => {
           {post.picture && (
             <div className="mb-6">
               <img 
-                src={`http://localhost:8080/uploads/${post.picture}`}
+                src={getImageUrl(post.picture, 'full')}
                 alt="Post image"
                 className="w-full rounded-lg bg-gray-200"
               />
             </div>
           )}
 
+          {/* Difficulty and materials */}
+          {(post.difficulty || (post.materials && post.materials.length > 0)) && (
+            <div className="mb-6">
+              {post.difficulty && (
+                <span className="inline-block px-3 py-1 mb-3 text-sm rounded-full bg-blue-100 text-blue-700 capitalize">
+                  {post.difficulty}
+                </span>
+              )}
+              {post.materials && post.materials.length > 0 && (
+                <>
+                  <h2 className="text-xl font-bold text-gray-900 mb-2">Materials</h2>
+                  <ul className="space-y-1">
+                    {post.materials.map((m) => (
+                      <li key={m.id}>
+                        <label className="flex items-center gap-2 text-gray-700">
+                          <input type="checkbox" />
+                          <span>{m.quantity ? `${m.quantity} ${m.name}` : m.name}</span>
+                        </label>
+                      </li>
+                    ))}
+                  </ul>
+                </>
+              )}
+            </div>
+          )}
+
+          {/* Steps */}
+          {post.steps && post.steps.length > 0 && (
+            <div className="mb-6">
+              <h2 className="text-xl font-bold text-gray-900 mb-2">Steps</h2>
+              <ol className="space-y-4">
+                {post.steps.map((step, index) => (
+                  <li key={step.id} className="flex gap-3">
+                    <input type="checkbox" className="mt-1" />
+                    <div className="flex-1">
+                      <p className="text-gray-700" style={{ whiteSpace: 'pre-line' }}>
+                        <span className="font-semibold">{index + 1}. </span>{step.text}
+                      </p>
+                      {step.duration_minutes > 0 && (
+                        <p className="text-sm text-gray-500">About {step.duration_minutes} min</p>
+                      )}
+                      {step.picture && (
+                        <img
+                          src={getImageUrl(step.picture, 'medium')}
+                          alt={`Step ${index + 1}`}
+                          className="mt-2 w-full rounded-lg bg-gray-200"
+                        />
+                      )}
+                    </div>
+                  </li>
+                ))}
+              </ol>
+            </div>
+          )}
+
+          {/* Attachments, in the author's order */}
+          {post.media && post.media.length > 0 && (
+            <div className="mb-6 space-y-4">
+              {post.media.map((item) => (
+                <figure key={item.id}>
+                  {item.kind === 'image' && (
+                    <img
+                      src={getImageUrl(item.image, 'medium')}
+                      alt={item.caption || 'Attachment'}
+                      className="w-full rounded-lg bg-gray-200"
+                    />
+                  )}
+                  {item.kind === 'video' && (
+                    <video src={getImageUrl(item.url)} controls className="w-full rounded-lg bg-black" />
+                  )}
+                  {item.kind === 'pdf' && (
+                    <a
+                      href={getImageUrl(item.url)}
+                      target="_blank"
+                      rel="noopener noreferrer"
+                      className="text-blue-600 underline"
+                    >
+                      {item.caption || 'Download PDF'}
+                    </a>
+                  )}
+                  {item.caption && item.kind !== 'pdf' && (
+                    <figcaption className="text-sm text-gray-600 mt-1">{item.caption}</figcaption>
+                  )}
+                </figure>
+              ))}
+            </div>
+          )}
+
           {/* YouTube Video */}
           {post.youtube_link && (
             <div className="mb-6">
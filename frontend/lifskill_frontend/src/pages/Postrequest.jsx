@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { Search, User, X, Check } from 'lucide-react';
 import Header from './Header';
+import { getImageUrl } from '../config';
 
 
 const PostRequests = () => {
@@ -155,13 +156,7 @@ const PostRequests = () => {
                         <img
                           src={
                             request.user && request.user.picture
-                              ? (
-                                  request.user.picture.startsWith('http')
-                                    ? request.user.picture
-                                    : request.user.picture.includes('uploads/profile_pictures/')
-                                      ? "http://localhost:8080/" + request.user.picture.replace(/^\.?\/?/, '')
-                                      : "http://localhost:8080/uploads/profile_pictures/" + encodeURIComponent(request.user.picture)
-                                )
+                              ? getImageUrl(request.user.picture, 'thumb')
                               : "/default-avatar.png"
                           }
                           alt="Profile"
@@ -212,7 +207,7 @@ const PostRequests = () => {
                   <div className="ml-4">
                     {request.picture && (
                       <img
-                        src={request.picture.startsWith('http') ? request.picture : `http://localhost:8080/uploads/${request.picture}`}
+                        src={getImageUrl(request.picture)}
                         alt="Post"
                         className="w-24 h-16 bg-gray-200 rounded-lg object-cover"
                         onError={e => {e.target.onerror=null; e.target.src='/default-profile.png';}}
@@ -236,13 +231,7 @@ const PostRequests = () => {
                   <img
                     src={
                       selectedRequest.user && selectedRequest.user.picture
-                        ? (
-                            selectedRequest.user.picture.startsWith('http')
-                              ? selectedRequest.user.picture
-                              : selectedRequest.user.picture.includes('uploads/profile_pictures/')
-                                ? "http://localhost:8080/" + selectedRequest.user.picture.replace(/^\.?\/?/, '')
-                                : "http://localhost:8080/uploads/profile_pictures/" + encodeURIComponent(selectedRequest.user.picture)
-                          )
+                        ? getImageUrl(selectedRequest.user.picture, 'thumb')
                         : "/default-avatar.png"
                     }
                     alt="Profile"
@@ -304,9 +293,7 @@ const PostRequests = () => {
               {selectedRequest.picture && (
                 <div className="mb-6">
                   <img
-                    src={selectedRequest.picture.startsWith('http') 
-                      ? selectedRequest.picture 
-                      : `http://localhost:8080/uploads/${selectedRequest.picture}`}
+                    src={getImageUrl(selectedRequest.picture, 'full')}
                     alt="Post"
                     className="w-full h-64 object-cover rounded-xl shadow-sm"
                     onError={e => {e.target.onerror=null; e.target.src='/default-profile.png';}}
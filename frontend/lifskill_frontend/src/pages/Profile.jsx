@@ -97,8 +97,8 @@ const handleChangePasswordSubmit = async () => {
         let talents = [];
         if (Array.isArray(user.talents) && typeof user.talents[0] === "string") {
           talents = user.talents;
-        } else if (Array.isArray(user.ExpertCategories)) {
-          talents = user.ExpertCategories.map(cat => cat.categories_name || cat.CategoriesName);
+        } else if (Array.isArray(user.expert_categories)) {
+          talents = user.expert_categories.map(cat => cat.categories_name || cat.CategoriesName);
         }
         setFormData({
           username: user.username || "",
@@ -108,11 +108,7 @@ const handleChangePasswordSubmit = async () => {
           talents: talents,
         });
         if (user.picture) {
-          let picPath = user.picture.replace(/^\.?\/?/, '');
-          if (!picPath.startsWith('http')) {
-            picPath = getImageUrl(picPath);
-          }
-          setProfileImage(picPath);
+          setProfileImage(getImageUrl(user.picture, 'medium'));
         } else {
           setProfileImage("/default-avatar.png");
         }
@@ -232,8 +228,8 @@ const handleChangePasswordSubmit = async () => {
         let talents = [];
         if (Array.isArray(user.talents) && typeof user.talents[0] === "string") {
           talents = user.talents;
-        } else if (Array.isArray(user.ExpertCategories)) {
-          talents = user.ExpertCategories.map(cat => cat.categories_name || cat.CategoriesName);
+        } else if (Array.isArray(user.expert_categories)) {
+          talents = user.expert_categories.map(cat => cat.categories_name || cat.CategoriesName);
         }
         setFormData({
           username: user.username || "",
@@ -243,11 +239,7 @@ const handleChangePasswordSubmit = async () => {
           talents: talents,
         });
         if (user.picture) {
-          let picPath = user.picture.replace(/^\.?\/?/, '');
-          if (!picPath.startsWith('http')) {
-            picPath = getImageUrl(picPath);
-          }
-          setProfileImage(picPath);
+          setProfileImage(getImageUrl(user.picture, 'medium'));
         } else {
           setProfileImage("/default-avatar.png");
         }
@@ -570,11 +562,7 @@ const handleChangePasswordSubmit = async () => {
                       <img
                         src={
                           post.user && post.user.picture
-                            ? (
-                                post.user.picture.startsWith('http')
-                                  ? post.user.picture
-                                  : getImageUrl(post.user.picture)
-                              )
+                            ? getImageUrl(post.user.picture, 'thumb')
                             : "/default-avatar.png"
                         }
                         alt="Profile"
@@ -610,7 +598,7 @@ const handleChangePasswordSubmit = async () => {
                   </div>
                   {post.picture ? (
                     <img
-                      src={`http://localhost:8080/uploads/${post.picture}`}
+                      src={getImageUrl(post.picture)}
                       alt="Post"
                       className="w-full md:w-40 h-32 object-cover rounded-lg mb-4 md:mb-0 md:ml-4"
                       onError={e => {e.target.onerror=null; e.target.src='/default-avatar.png';}}
@@ -4,11 +4,27 @@ import Header from './Header';
 import { Heart, MessageCircle, Search as SearchIcon, Home } from 'lucide-react';
 import { getApiUrl, getImageUrl } from '../config';
 
+// Renders text with <mark>...</mark> highlights from the search API as
+// React elements, so post text is never injected as HTML
+function Highlighted({ text }) {
+  const parts = text.split(/(<mark>.*?<\/mark>)/g);
+  return parts.map((part, i) =>
+    part.startsWith('<mark>') ? (
+      <mark key={i} className="bg-yellow-100 text-inherit rounded px-0.5">
+        {part.slice(6, -7)}
+      </mark>
+    ) : (
+      part
+    )
+  );
+}
+
 function Search() {
   const [searchParams] = useSearchParams();
   const [posts, setPosts] = useState([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
+  const [didYouMean, setDidYouMean] = useState(null);
   const query = searchParams.get('q');
 
   useEffect(() => {
@@ -20,6 +36,7 @@ function Search() {
       
       setLoading(true);
       setError(null);
+      setDidYouMean(null);
       
       try {
         const response = await fetch(getApiUrl(`/search_post?q=${encodeURIComponent(query)}`), {
@@ -33,6 +50,15 @@ function Search() {
         const data = await response.json();
         console.log('Search results:', data);
         setPosts(Array.isArray(data) ? data : []);
+
+        // Offer a spelling correction when nothing matched
+        if (!Array.isArray(data) || data.length === 0) {
+          const suggestResponse = await fetch(getApiUrl(`/search/suggest?q=${encodeURIComponent(query)}`));
+          if (suggestResponse.ok) {
+            const suggestions = await suggestResponse.json();
+            setDidYouMean(suggestions.did_you_mean || null);
+          }
+        }
       } catch (error) {
         console.error('Search error:', error);
         setError('Failed to perform search. Please try again.');
@@ -103,6 +129,18 @@ function Search() {
             <p className="text-gray-600 mb-2 text-lg">
               We couldn't find any posts matching "{query}"
             </p>
+            {didYouMean && (
+              <p className="text-gray-600 mb-6">
+                Did you mean{' '}
+                <Link
+                  to={`/search?q=${encodeURIComponent(didYouMean)}`}
+                  className="font-semibold text-teal-600 hover:underline"
+                >
+                  {didYouMean}
+                </Link>
+                ?
+              </p>
+            )}
             
 
             {/* Action Buttons */}
@@ -141,11 +179,7 @@ function Search() {
                           <img
                             src={
                               post.user && post.user.picture
-                                ? (
-                                    post.user.picture.startsWith('http')
-                                      ? post.user.picture
-                                      : getImageUrl(post.user.picture)
-                                  )
+                                ? getImageUrl(post.user.picture, 'thumb')
                                 : "/default-avatar.png"
                             }
                             alt={post.user?.username || 'User'}
@@ -160,10 +194,10 @@ function Search() {
                         {/* Post Content */}
                         <div className="space-y-3">
                           <h3 className="text-xl font-bold text-gray-900 group-hover:text-teal-600 transition-colors leading-tight">
-                            {post.title}
+                            {post.highlight ? <Highlighted text={post.highlight.title} /> : post.title}
                           </h3>
                           <p className="text-gray-600 leading-relaxed line-clamp-3">
-                            {post.content}
+                            {post.highlight ? <Highlighted text={post.highlight.snippet} /> : post.content}
                           </p>
                           {/* Categories */}
                           {Array.isArray(post.categories) && post.categories.length > 0 && (
@@ -197,7 +231,7 @@ function Search() {
                       {post.picture && (
                         <div className="lg:w-80 flex-shrink-0">
                           <img
-                            src={`http://localhost:8080/uploads/${post.picture}`}
+                            src={getImageUrl(post.picture)}
                             alt="Post image"
                             className="w-full h-48 lg:h-40 object-cover rounded-xl group-hover:scale-105 transition-transform duration-300"
                           />